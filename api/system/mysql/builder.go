@@ -0,0 +1,390 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// -------------------------------------------------------
+// построитель параметризованных запросов SELECT/UPDATE/DELETE
+// значения всегда передаются через плейсхолдеры,
+// идентификаторы экранируются обратными кавычками, а не подходящие под identifierRegex – ошибка построения
+// произвольный текст принимают только ColumnRaw, SetRaw и Where
+// -------------------------------------------------------
+
+const (
+	statementSelect = "SELECT"
+	statementUpdate = "UPDATE"
+	statementDelete = "DELETE"
+
+	OrderAsc  = "ASC"
+	OrderDesc = "DESC"
+)
+
+// идентификатор, который можно экранировать: column, table.column, db.table.column или *
+var identifierRegex = regexp.MustCompile(`^[A-Za-z0-9_$]+(\.([A-Za-z0-9_$]+|\*))*$|^\*$`)
+
+// QueryBuilderStruct построитель запроса
+type QueryBuilderStruct struct {
+	statement    string
+	tableName    string
+	columnList   []string
+	setList      []string
+	setArgList   []interface{}
+	whereList    []string
+	whereArgList []interface{}
+	orderList    []string
+	limit        int64
+	offset       int64
+	isForUpdate  bool
+	err          error
+}
+
+// -------------------------------------------------------
+// PUBLIC
+// -------------------------------------------------------
+
+// NewSelect начинаем запрос SELECT, колонки – имена, которые будут экранированы
+// выражения (COUNT(*) и т.п.) добавляются через ColumnRaw
+func NewSelect(tableName string, columnList ...string) *QueryBuilderStruct {
+
+	builder := &QueryBuilderStruct{statement: statementSelect, tableName: tableName, limit: -1}
+	for _, column := range columnList {
+		builder.columnList = append(builder.columnList, builder.quote(column))
+	}
+
+	return builder
+}
+
+// NewUpdate начинаем запрос UPDATE
+func NewUpdate(tableName string) *QueryBuilderStruct {
+
+	return &QueryBuilderStruct{statement: statementUpdate, tableName: tableName, limit: -1}
+}
+
+// NewDelete начинаем запрос DELETE
+func NewDelete(tableName string) *QueryBuilderStruct {
+
+	return &QueryBuilderStruct{statement: statementDelete, tableName: tableName, limit: -1}
+}
+
+// ColumnRaw добавляем в SELECT выражение, которое вставляется как есть, например ColumnRaw("COUNT(*) AS `count`")
+func (builder *QueryBuilderStruct) ColumnRaw(expression string) *QueryBuilderStruct {
+
+	builder.columnList = append(builder.columnList, expression)
+	return builder
+}
+
+// Set добавляем присвоение колонки для UPDATE
+func (builder *QueryBuilderStruct) Set(column string, value interface{}) *QueryBuilderStruct {
+
+	builder.setList = append(builder.setList, fmt.Sprintf("%s = ?", builder.quote(column)))
+	builder.setArgList = append(builder.setArgList, value)
+	return builder
+}
+
+// SetRaw добавляем присвоение выражения для UPDATE, например SetRaw("`count` = `count` + ?", 1)
+func (builder *QueryBuilderStruct) SetRaw(expression string, args ...interface{}) *QueryBuilderStruct {
+
+	builder.setList = append(builder.setList, expression)
+	builder.setArgList = append(builder.setArgList, args...)
+	return builder
+}
+
+// Where добавляем условие с плейсхолдерами, условия объединяются через AND
+func (builder *QueryBuilderStruct) Where(condition string, args ...interface{}) *QueryBuilderStruct {
+
+	builder.whereList = append(builder.whereList, "("+condition+")")
+	builder.whereArgList = append(builder.whereArgList, args...)
+	return builder
+}
+
+// WhereEq добавляем условие равенства колонки значению
+func (builder *QueryBuilderStruct) WhereEq(column string, value interface{}) *QueryBuilderStruct {
+
+	builder.whereList = append(builder.whereList, fmt.Sprintf("%s = ?", builder.quote(column)))
+	builder.whereArgList = append(builder.whereArgList, value)
+	return builder
+}
+
+// WhereIn добавляем условие вхождения колонки в список, слайс раскрывается в IN (?, ?, ?)
+// пустой список дает заведомо ложное условие
+func (builder *QueryBuilderStruct) WhereIn(column string, valueList interface{}) *QueryBuilderStruct {
+
+	argList, err := expandSlice(valueList)
+	if err != nil {
+
+		builder.setError(fmt.Errorf("where in `%s`: %v", column, err))
+		return builder
+	}
+
+	if len(argList) == 0 {
+
+		builder.whereList = append(builder.whereList, "(1 = 0)")
+		return builder
+	}
+
+	placeholderList := strings.TrimSuffix(strings.Repeat("?, ", len(argList)), ", ")
+	builder.whereList = append(builder.whereList, fmt.Sprintf("%s IN (%s)", builder.quote(column), placeholderList))
+	builder.whereArgList = append(builder.whereArgList, argList...)
+	return builder
+}
+
+// OrderBy добавляем сортировку по колонке, направление – OrderAsc или OrderDesc
+func (builder *QueryBuilderStruct) OrderBy(column string, direction string) *QueryBuilderStruct {
+
+	direction = strings.ToUpper(direction)
+	if direction != OrderAsc && direction != OrderDesc {
+
+		builder.setError(fmt.Errorf("incorrect order direction '%s'", direction))
+		return builder
+	}
+
+	builder.orderList = append(builder.orderList, fmt.Sprintf("%s %s", builder.quote(column), direction))
+	return builder
+}
+
+// Limit ограничиваем количество строк
+func (builder *QueryBuilderStruct) Limit(limit int64) *QueryBuilderStruct {
+
+	builder.limit = limit
+	return builder
+}
+
+// Offset пропускаем строки, применяется только вместе с Limit в SELECT
+func (builder *QueryBuilderStruct) Offset(offset int64) *QueryBuilderStruct {
+
+	builder.offset = offset
+	return builder
+}
+
+// ForUpdate блокируем выбранные строки, только для SELECT
+func (builder *QueryBuilderStruct) ForUpdate() *QueryBuilderStruct {
+
+	builder.isForUpdate = true
+	return builder
+}
+
+// Build собираем текст запроса и аргументы
+func (builder *QueryBuilderStruct) Build() (string, []interface{}, error) {
+
+	if builder.tableName == "" {
+		return "", nil, fmt.Errorf("table name is empty")
+	}
+
+	tableName := builder.quote(builder.tableName)
+	if builder.err != nil {
+		return "", nil, builder.err
+	}
+
+	var query strings.Builder
+	var argList []interface{}
+
+	switch builder.statement {
+	case statementSelect:
+
+		columnList := builder.columnList
+		if len(columnList) == 0 {
+			columnList = []string{"*"}
+		}
+		query.WriteString(fmt.Sprintf("SELECT %s FROM %s", strings.Join(columnList, ", "), tableName))
+	case statementUpdate:
+
+		if len(builder.setList) == 0 {
+			return "", nil, fmt.Errorf("update `%s` without set", builder.tableName)
+		}
+
+		query.WriteString(fmt.Sprintf("UPDATE %s SET %s", tableName, strings.Join(builder.setList, ", ")))
+		argList = append(argList, builder.setArgList...)
+	case statementDelete:
+
+		query.WriteString(fmt.Sprintf("DELETE FROM %s", tableName))
+	}
+
+	// изменение всей таблицы без условия почти всегда ошибка
+	if builder.statement != statementSelect && len(builder.whereList) == 0 {
+		return "", nil, fmt.Errorf("%s `%s` without where", strings.ToLower(builder.statement), builder.tableName)
+	}
+
+	if len(builder.whereList) > 0 {
+
+		query.WriteString(" WHERE " + strings.Join(builder.whereList, " AND "))
+		argList = append(argList, builder.whereArgList...)
+	}
+
+	if len(builder.orderList) > 0 {
+		query.WriteString(" ORDER BY " + strings.Join(builder.orderList, ", "))
+	}
+
+	if builder.limit >= 0 {
+
+		query.WriteString(" LIMIT ?")
+		argList = append(argList, builder.limit)
+
+		if builder.offset > 0 && builder.statement == statementSelect {
+
+			query.WriteString(" OFFSET ?")
+			argList = append(argList, builder.offset)
+		}
+	}
+
+	if builder.isForUpdate {
+
+		if builder.statement != statementSelect {
+			return "", nil, fmt.Errorf("for update is allowed only for select")
+		}
+		query.WriteString(" FOR UPDATE")
+	}
+
+	return query.String(), argList, nil
+}
+
+// Select выполняем SELECT из построителя и получаем массив
+func (connectionItem *ConnectionPoolItem) Select(ctx context.Context, builder *QueryBuilderStruct) (map[int]map[string]string, error) {
+
+	query, argList, err := builder.Build()
+	if err != nil {
+		return map[int]map[string]string{}, err
+	}
+
+	return connectionItem.GetAll(ctx, query, argList...)
+}
+
+// SelectOne выполняем SELECT из построителя и получаем одну строку
+func (connectionItem *ConnectionPoolItem) SelectOne(ctx context.Context, builder *QueryBuilderStruct) (map[string]string, error) {
+
+	query, argList, err := builder.Build()
+	if err != nil {
+		return map[string]string{}, err
+	}
+
+	return connectionItem.FetchQuery(ctx, query, argList...)
+}
+
+// Exec выполняем UPDATE/DELETE из построителя и получаем количество измененных строк
+func (connectionItem *ConnectionPoolItem) Exec(ctx context.Context, builder *QueryBuilderStruct) (int64, error) {
+
+	query, argList, err := builder.Build()
+	if err != nil {
+		return 0, err
+	}
+
+	return connectionItem.Update(ctx, query, argList...)
+}
+
+// Select выполняем SELECT из построителя в транзакции и получаем массив
+func (transactionItem *TransactionStruct) Select(ctx context.Context, builder *QueryBuilderStruct) (map[int]map[string]string, error) {
+
+	query, argList, err := builder.Build()
+	if err != nil {
+		return map[int]map[string]string{}, err
+	}
+
+	return transactionItem.GetAll(ctx, query, argList...)
+}
+
+// SelectOne выполняем SELECT из построителя в транзакции и получаем одну строку
+func (transactionItem *TransactionStruct) SelectOne(ctx context.Context, builder *QueryBuilderStruct) (map[string]string, error) {
+
+	query, argList, err := builder.Build()
+	if err != nil {
+		return map[string]string{}, err
+	}
+
+	return transactionItem.FetchQuery(ctx, query, argList...)
+}
+
+// Exec выполняем UPDATE/DELETE из построителя в транзакции и получаем количество измененных строк
+func (transactionItem *TransactionStruct) Exec(ctx context.Context, builder *QueryBuilderStruct) (int64, error) {
+
+	query, argList, err := builder.Build()
+	if err != nil {
+		return 0, err
+	}
+
+	return transactionItem.Update(ctx, query, argList...)
+}
+
+// QuoteIdentifier экранируем имя таблицы или колонки вида name или db.name для запроса, собранного вне построителя
+func QuoteIdentifier(identifier string) (string, error) {
+
+	return quoteIdentifier(identifier)
+}
+
+// -------------------------------------------------------
+// PROTECTED
+// -------------------------------------------------------
+
+// запоминаем первую ошибку построения
+func (builder *QueryBuilderStruct) setError(err error) {
+
+	if builder.err == nil {
+		builder.err = err
+	}
+}
+
+// экранируем идентификатор, ошибку запоминаем до Build
+func (builder *QueryBuilderStruct) quote(identifier string) string {
+
+	quoted, err := quoteIdentifier(identifier)
+	if err != nil {
+		builder.setError(err)
+	}
+
+	return quoted
+}
+
+// экранируем идентификатор обратными кавычками, все, что не похоже на идентификатор, – ошибка
+func quoteIdentifier(identifier string) (string, error) {
+
+	identifier = strings.TrimSpace(identifier)
+	if !identifierRegex.MatchString(identifier) {
+		return "", fmt.Errorf("incorrect identifier '%s'", identifier)
+	}
+
+	partList := strings.Split(identifier, ".")
+	for i, part := range partList {
+
+		if part == "*" {
+			continue
+		}
+		partList[i] = "`" + part + "`"
+	}
+
+	return strings.Join(partList, "."), nil
+}
+
+// экранируем список идентификаторов
+func quoteIdentifierList(identifierList []string) ([]string, error) {
+
+	quotedList := make([]string, 0, len(identifierList))
+	for _, identifier := range identifierList {
+
+		quoted, err := quoteIdentifier(identifier)
+		if err != nil {
+			return nil, err
+		}
+		quotedList = append(quotedList, quoted)
+	}
+
+	return quotedList, nil
+}
+
+// раскрываем слайс в список аргументов
+func expandSlice(valueList interface{}) ([]interface{}, error) {
+
+	value := reflect.ValueOf(valueList)
+	if value.Kind() != reflect.Slice && value.Kind() != reflect.Array {
+		return nil, fmt.Errorf("expected slice, got %T", valueList)
+	}
+
+	argList := make([]interface{}, 0, value.Len())
+	for i := 0; i < value.Len(); i++ {
+		argList = append(argList, value.Index(i).Interface())
+	}
+
+	return argList, nil
+}
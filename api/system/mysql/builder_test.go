@@ -0,0 +1,46 @@
+package mysql
+
+import (
+	"testing"
+)
+
+// проверяем, что идентификаторы экранируются, а все остальное не попадает в запрос
+func TestQueryBuilderIdentifier(t *testing.T) {
+
+	caseList := []struct {
+		name    string
+		builder *QueryBuilderStruct
+		query   string
+	}{
+		{"select", NewSelect("db.user", "id", "u.name").WhereEq("id", 1).OrderBy("name", "desc"), "SELECT `id`, `u`.`name` FROM `db`.`user` WHERE `id` = ? ORDER BY `name` DESC"},
+		{"select raw column", NewSelect("user").ColumnRaw("COUNT(*)").WhereIn("id", []int{1, 2}), "SELECT COUNT(*) FROM `user` WHERE `id` IN (?, ?)"},
+		{"update", NewUpdate("user").Set("name", "a").SetRaw("`count` = `count` + ?", 1).Where("`id` > ?", 1), "UPDATE `user` SET `name` = ?, `count` = `count` + ? WHERE (`id` > ?)"},
+		{"table", NewDelete("user; DROP TABLE user").WhereEq("id", 1), ""},
+		{"select column", NewSelect("user", "id FROM user; --"), ""},
+		{"set", NewUpdate("user").Set("name = 1, is_admin", 1).WhereEq("id", 1), ""},
+		{"where eq", NewSelect("user").WhereEq("1 = 1 OR id", 1), ""},
+		{"where in", NewSelect("user").WhereIn("id) OR (1", []int{1}), ""},
+		{"order by", NewSelect("user").OrderBy("IF(1, id, name)", OrderAsc), ""},
+	}
+
+	for _, c := range caseList {
+
+		t.Run(c.name, func(t *testing.T) {
+
+			query, _, err := c.builder.Build()
+			if c.query == "" {
+
+				if err == nil {
+					t.Fatalf("expected error, got query %q", query)
+				}
+				return
+			}
+
+			if err != nil || query != c.query {
+				t.Fatalf("query = %q, err = %v, want %q", query, err, c.query)
+			}
+		})
+	}
+}
+
+// проверяем, что запись структур и массовая вставка не принимают некорректные идентификаторы
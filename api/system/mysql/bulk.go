@@ -0,0 +1,264 @@
+package mysql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// -------------------------------------------------------
+// массовая вставка
+// строки делятся на пачки так, чтобы запрос не превысил
+// лимит плейсхолдеров и max_allowed_packet сервера
+// -------------------------------------------------------
+
+const (
+	BulkInsertModeInsert  = 0 // обычный INSERT
+	BulkInsertModeIgnore  = 1 // INSERT IGNORE, как в InsertArray
+	BulkInsertModeReplace = 2 // REPLACE
+	BulkInsertModeUpdate  = 3 // INSERT ... ON DUPLICATE KEY UPDATE
+
+	maxPlaceholderCount  = 65535           // больше плейсхолдеров в одном запросе сервер не принимает
+	defaultMaxPacketSize = 4 * 1024 * 1024 // max_allowed_packet по умолчанию в MySQL 5.7
+	valueSizeOverhead    = 16              // запас на каждое значение: заголовок и тип в пакете
+)
+
+// ErrBulkInsertRowSize строка не совпадает со списком колонок
+var ErrBulkInsertRowSize = errors.New("bulk insert row size does not match column list")
+
+// BulkInsertConfigStruct настройки массовой вставки
+type BulkInsertConfigStruct struct {
+	Mode             int      // режим вставки: BulkInsertModeInsert, BulkInsertModeIgnore, BulkInsertModeReplace или BulkInsertModeUpdate
+	UpdateColumnList []string // колонки для ON DUPLICATE KEY UPDATE, пусто – все колонки
+	MaxPlaceholders  int      // максимум плейсхолдеров в пачке, 0 – лимит сервера
+	MaxPacketSize    int      // максимальный размер пачки в байтах, 0 – 4 МБ
+	IsTransaction    bool     // выполнять все пачки в одной транзакции
+}
+
+// BulkQueryStruct запрос для одной пачки строк
+type BulkQueryStruct struct {
+	Query   string
+	ArgList []interface{}
+}
+
+// -------------------------------------------------------
+// PUBLIC
+// -------------------------------------------------------
+
+// FormatBulkInsert готовим запросы массовой вставки, разбитые на пачки
+func FormatBulkInsert(tableName string, columnList []string, insertDataList [][]interface{}, config BulkInsertConfigStruct) ([]BulkQueryStruct, error) {
+
+	if len(columnList) == 0 {
+		return nil, fmt.Errorf("bulk insert into %s without columns", tableName)
+	}
+
+	prefix, suffix, err := formatBulkInsertQuery(tableName, columnList, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return splitBulkInsert(prefix, suffix, len(columnList), insertDataList, config)
+}
+
+// BulkInsert массово вставляем строки пачками, возвращаем общее количество измененных строк
+func (connectionItem *ConnectionPoolItem) BulkInsert(ctx context.Context, tableName string, columnList []string, insertDataList [][]interface{}, config BulkInsertConfigStruct) (int64, error) {
+
+	queryList, err := FormatBulkInsert(tableName, columnList, insertDataList, config)
+	if err != nil {
+		return 0, err
+	}
+
+	if config.IsTransaction {
+
+		var rowsAffected int64
+		err = connectionItem.RunInTransaction(ctx, nil, func(transactionItem *TransactionStruct) error {
+
+			rowsAffected, err = transactionItem.execBulkQueryList(ctx, queryList)
+			return err
+		})
+		if err != nil {
+			return 0, err
+		}
+
+		return rowsAffected, nil
+	}
+
+	return connectionItem.execBulkQueryList(ctx, queryList)
+}
+
+// BulkInsert массово вставляем строки пачками в транзакции, возвращаем общее количество измененных строк
+func (transactionItem *TransactionStruct) BulkInsert(ctx context.Context, tableName string, columnList []string, insertDataList [][]interface{}, config BulkInsertConfigStruct) (int64, error) {
+
+	queryList, err := FormatBulkInsert(tableName, columnList, insertDataList, config)
+	if err != nil {
+		return 0, err
+	}
+
+	return transactionItem.execBulkQueryList(ctx, queryList)
+}
+
+// -------------------------------------------------------
+// PROTECTED
+// -------------------------------------------------------
+
+// выполняем пачки по очереди
+func (connectionItem *ConnectionPoolItem) execBulkQueryList(ctx context.Context, queryList []BulkQueryStruct) (int64, error) {
+
+	var rowsAffected int64
+	for _, bulkQuery := range queryList {
+
+		rows, err := connectionItem.Update(ctx, bulkQuery.Query, bulkQuery.ArgList...)
+		if err != nil {
+			return rowsAffected, err
+		}
+		rowsAffected += rows
+	}
+
+	return rowsAffected, nil
+}
+
+// выполняем пачки в транзакции
+func (transactionItem *TransactionStruct) execBulkQueryList(ctx context.Context, queryList []BulkQueryStruct) (int64, error) {
+
+	var rowsAffected int64
+	for _, bulkQuery := range queryList {
+
+		rows, err := transactionItem.Update(ctx, bulkQuery.Query, bulkQuery.ArgList...)
+		if err != nil {
+			return rowsAffected, err
+		}
+		rowsAffected += rows
+	}
+
+	return rowsAffected, nil
+}
+
+// получаем начало и конец запроса вставки для режима
+func formatBulkInsertQuery(tableName string, columnList []string, config BulkInsertConfigStruct) (string, string, error) {
+
+	quotedTableName, err := quoteIdentifier(tableName)
+	if err != nil {
+		return "", "", err
+	}
+
+	quotedColumnList, err := quoteIdentifierList(columnList)
+	if err != nil {
+		return "", "", err
+	}
+
+	verb := "INSERT INTO"
+	switch config.Mode {
+	case BulkInsertModeIgnore:
+		verb = "INSERT IGNORE INTO"
+	case BulkInsertModeReplace:
+		verb = "REPLACE INTO"
+	}
+	prefix := fmt.Sprintf("%s %s (%s) VALUES ", verb, quotedTableName, strings.Join(quotedColumnList, ", "))
+
+	if config.Mode != BulkInsertModeUpdate {
+		return prefix, "", nil
+	}
+
+	updateColumnList := quotedColumnList
+	if len(config.UpdateColumnList) > 0 {
+
+		updateColumnList, err = quoteIdentifierList(config.UpdateColumnList)
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	updateList := make([]string, 0, len(updateColumnList))
+	for _, column := range updateColumnList {
+		updateList = append(updateList, fmt.Sprintf("%s = VALUES(%s)", column, column))
+	}
+
+	return prefix, " ON DUPLICATE KEY UPDATE " + strings.Join(updateList, ", "), nil
+}
+
+// делим строки на пачки с общим началом и концом запроса
+func splitBulkInsert(prefix string, suffix string, columnCount int, insertDataList [][]interface{}, config BulkInsertConfigStruct) ([]BulkQueryStruct, error) {
+
+	rowPlaceholder := "(" + strings.TrimSuffix(strings.Repeat("?, ", columnCount), ", ") + ")"
+
+	maxPlaceholders := config.MaxPlaceholders
+	if maxPlaceholders <= 0 || maxPlaceholders > maxPlaceholderCount {
+		maxPlaceholders = maxPlaceholderCount
+	}
+	maxPacketSize := config.MaxPacketSize
+	if maxPacketSize <= 0 {
+		maxPacketSize = defaultMaxPacketSize
+	}
+
+	// строк в пачке не больше, чем позволяет лимит плейсхолдеров, но хотя бы одна
+	maxRowCount := maxPlaceholders / columnCount
+	if maxRowCount == 0 {
+		maxRowCount = 1
+	}
+
+	var queryList []BulkQueryStruct
+	var rowCount, size int
+	var argList []interface{}
+	for i, insertData := range insertDataList {
+
+		if len(insertData) != columnCount {
+			return nil, fmt.Errorf("%w: row %d has %d values, expected %d", ErrBulkInsertRowSize, i, len(insertData), columnCount)
+		}
+
+		rowSize := len(rowPlaceholder) + 2
+		for _, value := range insertData {
+			rowSize += getValueSize(value) + valueSizeOverhead
+		}
+
+		// закрываем пачку, если строка в нее не помещается
+		if rowCount > 0 && (rowCount >= maxRowCount || len(prefix)+len(suffix)+size+rowSize > maxPacketSize) {
+
+			queryList = append(queryList, formatBulkQuery(prefix, suffix, rowPlaceholder, rowCount, argList))
+			rowCount, size, argList = 0, 0, nil
+		}
+
+		argList = append(argList, insertData...)
+		rowCount++
+		size += rowSize
+	}
+
+	if rowCount > 0 {
+		queryList = append(queryList, formatBulkQuery(prefix, suffix, rowPlaceholder, rowCount, argList))
+	}
+
+	return queryList, nil
+}
+
+// собираем запрос для пачки
+func formatBulkQuery(prefix string, suffix string, rowPlaceholder string, rowCount int, argList []interface{}) BulkQueryStruct {
+
+	query := prefix + strings.TrimSuffix(strings.Repeat(rowPlaceholder+", ", rowCount), ", ") + suffix
+	return BulkQueryStruct{Query: query, ArgList: argList}
+}
+
+// оцениваем размер значения в пакете
+func getValueSize(value interface{}) int {
+
+	switch v := value.(type) {
+	case nil:
+		return 0
+	case string:
+		return len(v)
+	case []byte:
+		return len(v)
+	case bool, int8, uint8:
+		return 1
+	case int16, uint16:
+		return 2
+	case int32, uint32, float32:
+		return 4
+	case int, int64, uint, uint64, float64:
+		return 8
+	case time.Time:
+		return len(v.Format(time.RFC3339Nano))
+	default:
+		return len(fmt.Sprint(v))
+	}
+}
@@ -0,0 +1,65 @@
+package mysql
+
+import (
+	"testing"
+)
+
+// проверяем, что массовая вставка не принимает некорректные идентификаторы
+func TestFormatBulkInsertIdentifier(t *testing.T) {
+
+	caseList := []struct {
+		name       string
+		tableName  string
+		columnList []string
+		config     BulkInsertConfigStruct
+	}{
+		{"table", "user; DROP TABLE user", []string{"id"}, BulkInsertConfigStruct{}},
+		{"column", "user", []string{"id", "name)"}, BulkInsertConfigStruct{}},
+		{"update column", "user", []string{"id"}, BulkInsertConfigStruct{Mode: BulkInsertModeUpdate, UpdateColumnList: []string{"id = 1, name"}}},
+	}
+
+	for _, c := range caseList {
+
+		t.Run(c.name, func(t *testing.T) {
+
+			insertData := make([]interface{}, len(c.columnList))
+			if _, err := FormatBulkInsert(c.tableName, c.columnList, [][]interface{}{insertData}, c.config); err == nil {
+				t.Fatalf("expected error")
+			}
+		})
+	}
+}
+
+// проверяем, что InsertArray сохраняет прежнее экранирование и делит большой массив на пачки
+func TestInsertArray(t *testing.T) {
+
+	queryList, err := InsertArray("user-list", []string{"`id`", "name"}, [][]interface{}{{1, "a"}, {2, "b"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(queryList) != 1 || queryList[0].Query != "INSERT IGNORE INTO `user-list` (`id`, name) VALUES (?, ?), (?, ?)" {
+		t.Fatalf("queryList = %v", queryList)
+	}
+
+	insertDataList := make([][]interface{}, maxPlaceholderCount)
+	for i := range insertDataList {
+		insertDataList[i] = []interface{}{i, "a"}
+	}
+
+	queryList, err = InsertArray("user", []string{"id", "name"}, insertDataList)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rowCount := 0
+	for _, bulkQuery := range queryList {
+
+		if len(bulkQuery.ArgList) > maxPlaceholderCount || len(bulkQuery.Query) > defaultMaxPacketSize {
+			t.Fatalf("chunk exceeds limits: %d placeholders, %d bytes", len(bulkQuery.ArgList), len(bulkQuery.Query))
+		}
+		rowCount += len(bulkQuery.ArgList) / 2
+	}
+	if len(queryList) < 2 || rowCount != len(insertDataList) {
+		t.Fatalf("got %d chunks with %d rows, want at least 2 chunks with %d rows", len(queryList), rowCount, len(insertDataList))
+	}
+}
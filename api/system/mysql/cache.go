@@ -0,0 +1,279 @@
+package mysql
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getCompassUtils/go_base_frame/api/system/log"
+)
+
+// -------------------------------------------------------
+// кэш ответов на запросы чтения
+// ответ кэшируется по хосту, базе, тексту запроса и аргументам и помечается тегами таблиц, из которых он прочитан,
+// запись в таблицу через тот же пул сбрасывает все ответы с ее тегом
+// -------------------------------------------------------
+
+// QueryCacheBackendInterface хранилище кэша, например память процесса или внешний кэш
+type QueryCacheBackendInterface interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte, ttl time.Duration, tagList []string)
+	InvalidateTag(tag string)
+}
+
+// MemoryQueryCacheStruct кэш в памяти процесса с ограничением по размеру и времени жизни
+type MemoryQueryCacheStruct struct {
+	mu       sync.Mutex
+	capacity int
+	list     *list.List                 // от недавно использованных к давно не использованным
+	itemMap  map[string]*list.Element   // ключ -> элемент списка
+	tagMap   map[string]map[string]bool // тег -> ключи с этим тегом
+}
+
+// запись кэша в памяти
+type memoryCacheItemStruct struct {
+	key      string
+	value    []byte
+	expireAt time.Time
+	tagList  []string
+}
+
+// настройки кэша пула
+type queryCacheStruct struct {
+	backend QueryCacheBackendInterface
+	ttl     time.Duration
+}
+
+// -------------------------------------------------------
+// PUBLIC
+// -------------------------------------------------------
+
+// NewMemoryQueryCache создаем кэш в памяти на capacity ответов
+func NewMemoryQueryCache(capacity int) *MemoryQueryCacheStruct {
+
+	return &MemoryQueryCacheStruct{
+		capacity: capacity,
+		list:     list.New(),
+		itemMap:  make(map[string]*list.Element),
+		tagMap:   make(map[string]map[string]bool),
+	}
+}
+
+// Get получаем значение, просроченное значение удаляется
+func (cache *MemoryQueryCacheStruct) Get(key string) ([]byte, bool) {
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	element, exist := cache.itemMap[key]
+	if !exist {
+		return nil, false
+	}
+
+	item := element.Value.(*memoryCacheItemStruct)
+	if time.Now().After(item.expireAt) {
+
+		cache.remove(element)
+		return nil, false
+	}
+
+	cache.list.MoveToFront(element)
+	return item.value, true
+}
+
+// Set сохраняем значение с временем жизни и тегами
+func (cache *MemoryQueryCacheStruct) Set(key string, value []byte, ttl time.Duration, tagList []string) {
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if element, exist := cache.itemMap[key]; exist {
+		cache.remove(element)
+	}
+
+	item := &memoryCacheItemStruct{key: key, value: value, expireAt: time.Now().Add(ttl), tagList: tagList}
+	cache.itemMap[key] = cache.list.PushFront(item)
+
+	for _, tag := range tagList {
+
+		if cache.tagMap[tag] == nil {
+			cache.tagMap[tag] = make(map[string]bool)
+		}
+		cache.tagMap[tag][key] = true
+	}
+
+	for cache.list.Len() > cache.capacity {
+		cache.remove(cache.list.Back())
+	}
+}
+
+// InvalidateTag удаляем все значения с тегом
+func (cache *MemoryQueryCacheStruct) InvalidateTag(tag string) {
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	for key := range cache.tagMap[tag] {
+
+		if element, exist := cache.itemMap[key]; exist {
+			cache.remove(element)
+		}
+	}
+	delete(cache.tagMap, tag)
+}
+
+// SetQueryCache включаем кэш ответов для методов *Cached, backend nil – выключаем
+func (connectionItem *ConnectionPoolItem) SetQueryCache(backend QueryCacheBackendInterface, ttl time.Duration) {
+
+	if backend == nil || ttl <= 0 {
+
+		connectionItem.queryCache.Store(nil)
+		return
+	}
+
+	connectionItem.queryCache.Store(&queryCacheStruct{backend: backend, ttl: ttl})
+}
+
+// FetchQueryCached получаем ответ как FetchQuery, сначала ищем его в кэше
+func (connectionItem *ConnectionPoolItem) FetchQueryCached(ctx context.Context, query string, args ...interface{}) (map[string]string, error) {
+
+	return fetchCached(connectionItem, func() (map[string]string, error) {
+		return connectionItem.FetchQuery(ctx, query, args...)
+	}, query, args...)
+}
+
+// GetAllCached получаем массив как GetAll, сначала ищем его в кэше
+func (connectionItem *ConnectionPoolItem) GetAllCached(ctx context.Context, query string, args ...interface{}) (map[int]map[string]string, error) {
+
+	return fetchCached(connectionItem, func() (map[int]map[string]string, error) {
+		return connectionItem.GetAll(ctx, query, args...)
+	}, query, args...)
+}
+
+// InvalidateQueryCacheTable сбрасываем закэшированные ответы, прочитанные из таблицы
+func (connectionItem *ConnectionPoolItem) InvalidateQueryCacheTable(tableName string) {
+
+	queryCache := connectionItem.queryCache.Load()
+	if queryCache == nil {
+		return
+	}
+
+	queryCache.backend.InvalidateTag(connectionItem.getTableTag(strings.ToLower(strings.ReplaceAll(tableName, "`", ""))))
+}
+
+// -------------------------------------------------------
+// PROTECTED
+// -------------------------------------------------------
+
+// удаляем запись из кэша
+func (cache *MemoryQueryCacheStruct) remove(element *list.Element) {
+
+	item := cache.list.Remove(element).(*memoryCacheItemStruct)
+	delete(cache.itemMap, item.key)
+
+	for _, tag := range item.tagList {
+
+		delete(cache.tagMap[tag], item.key)
+		if len(cache.tagMap[tag]) == 0 {
+			delete(cache.tagMap, tag)
+		}
+	}
+}
+
+// получаем ответ из кэша или выполняем запрос и сохраняем ответ
+func fetchCached[R any](connectionItem *ConnectionPoolItem, fetch func() (R, error), query string, args ...interface{}) (R, error) {
+
+	queryCache := connectionItem.queryCache.Load()
+	if queryCache == nil {
+		return fetch()
+	}
+
+	key := connectionItem.getQueryCacheKey(query, args...)
+	if value, exist := queryCache.backend.Get(key); exist {
+
+		var response R
+		err := json.Unmarshal(value, &response)
+		if err == nil {
+			return response, nil
+		}
+		log.Errorf("unable decode cached response, query: %s, error: %v", query, err)
+	}
+
+	response, err := fetch()
+	if err != nil {
+		return response, err
+	}
+
+	value, err := json.Marshal(response)
+	if err != nil {
+
+		log.Errorf("unable encode response for cache, query: %s, error: %v", query, err)
+		return response, nil
+	}
+
+	var tagList []string
+	for _, table := range getReadTableList(query) {
+		tagList = append(tagList, connectionItem.getTableTag(table))
+	}
+	queryCache.backend.Set(key, value, queryCache.ttl, tagList)
+
+	return response, nil
+}
+
+// сбрасываем кэш таблиц, которые изменил запрос
+func (connectionItem *ConnectionPoolItem) invalidateQueryCache(query string) {
+
+	if connectionItem == nil || connectionItem.queryCache.Load() == nil {
+		return
+	}
+
+	for _, table := range parseStatement(query).tableList {
+		connectionItem.InvalidateQueryCacheTable(table)
+	}
+}
+
+// запоминаем запрос на запись, чтобы сбросить кэш пула после подтверждения транзакции
+func (transactionItem *TransactionStruct) rememberWriteQuery(query string) {
+
+	if transactionItem.connectionItem == nil || transactionItem.connectionItem.queryCache.Load() == nil {
+		return
+	}
+
+	// подготовленный запрос вставки выполняется для каждой строки – храним его один раз
+	if count := len(transactionItem.writeQueryList); count > 0 && transactionItem.writeQueryList[count-1] == query {
+		return
+	}
+
+	transactionItem.writeQueryList = append(transactionItem.writeQueryList, query)
+}
+
+// получаем ключ кэша по хосту, базе, запросу и аргументам с их типами
+func (connectionItem *ConnectionPoolItem) getQueryCacheKey(query string, args ...interface{}) string {
+
+	var keyBuilder strings.Builder
+	keyBuilder.WriteString(connectionItem.host + "\x00" + connectionItem.dbKey + "\x00" + query)
+	for _, arg := range args {
+		keyBuilder.WriteString(fmt.Sprintf("\x00%T:%v", arg, arg))
+	}
+
+	hash := sha1.Sum([]byte(keyBuilder.String()))
+	return "mysql_query:" + hex.EncodeToString(hash[:])
+}
+
+// получаем тег таблицы на хосте пула, таблица без базы относится к базе пула
+// одноименные базы на разных хостах – разные данные, поэтому хост входит в тег
+func (connectionItem *ConnectionPoolItem) getTableTag(table string) string {
+
+	prefix := "mysql_table:" + strings.ToLower(connectionItem.host) + "/"
+	if strings.Contains(table, ".") {
+		return prefix + table
+	}
+
+	return prefix + strings.ToLower(connectionItem.dbKey) + "." + table
+}
@@ -0,0 +1,50 @@
+package mysql
+
+import (
+	"testing"
+	"time"
+)
+
+// проверяем, что одноименные базы на разных хостах не делят ответы в кэше
+func TestQueryCacheHost(t *testing.T) {
+
+	backend := NewMemoryQueryCache(10)
+	firstItem := &ConnectionPoolItem{dbKey: "company", host: "mysql-1"}
+	secondItem := &ConnectionPoolItem{dbKey: "company", host: "mysql-2"}
+	firstItem.SetQueryCache(backend, time.Minute)
+	secondItem.SetQueryCache(backend, time.Minute)
+
+	query := "SELECT * FROM `user` WHERE `id` = ?"
+	if firstItem.getQueryCacheKey(query, 1) == secondItem.getQueryCacheKey(query, 1) {
+		t.Fatalf("pools on different hosts have the same cache key")
+	}
+
+	fetchCount := 0
+	fetch := func() (map[string]string, error) {
+
+		fetchCount++
+		return map[string]string{"id": "1"}, nil
+	}
+
+	for _, connectionItem := range []*ConnectionPoolItem{firstItem, secondItem, firstItem, secondItem} {
+
+		if _, err := fetchCached(connectionItem, fetch, query, 1); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if fetchCount != 2 {
+		t.Fatalf("fetch count = %d, want 2", fetchCount)
+	}
+
+	// запись в таблицу на одном хосте не сбрасывает кэш другого
+	firstItem.InvalidateQueryCacheTable("user")
+	for _, connectionItem := range []*ConnectionPoolItem{firstItem, secondItem} {
+
+		if _, err := fetchCached(connectionItem, fetch, query, 1); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if fetchCount != 3 {
+		t.Fatalf("fetch count = %d, want 3", fetchCount)
+	}
+}
@@ -0,0 +1,519 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/getCompassUtils/go_base_frame/api/system/functions"
+	"github.com/getCompassUtils/go_base_frame/api/system/log"
+)
+
+// -------------------------------------------------------
+// кластер из основного сервера и реплик
+// чтение уходит на здоровые реплики, запись, транзакции и блокирующее чтение – на основной сервер
+// -------------------------------------------------------
+
+const (
+	ReplicaSelectRoundRobin   = 1 // реплики выбираются по очереди
+	ReplicaSelectLeastLatency = 2 // выбирается реплика с наименьшей задержкой пинга
+
+	defaultClusterCheckInterval = 5 * time.Second  // как часто проверяем реплики
+	defaultMaxReplicationLag    = 10 * time.Second // допустимое отставание реплики
+)
+
+// ClusterConfigStruct конфигурация кластера
+// узлы задаются либо хостами с общими Db, User, Pass, MaxConnections и IsSsl,
+// либо полной конфигурацией соединения с пулом, таймаутами и tls для каждого узла
+type ClusterConfigStruct struct {
+	Db                  string                   // база данных
+	User                string                   // пользователь
+	Pass                string                   // пароль
+	PrimaryHost         string                   // хост основного сервера
+	ReplicaHostList     []string                 // хосты реплик
+	MaxConnections      int                      // максимальное количество соединений в каждом пуле
+	IsSsl               bool                     // использовать ли ssl
+	Primary             *ConnectionConfigStruct  // конфигурация основного сервера, если задана – вместо PrimaryHost и общих полей
+	ReplicaList         []ConnectionConfigStruct // конфигурации реплик, добавляются к ReplicaHostList
+	SelectPolicy        int                      // как выбирать реплику: ReplicaSelectRoundRobin или ReplicaSelectLeastLatency
+	MaxReplicationLag   time.Duration            // реплика с большим отставанием выводится из ротации
+	HealthCheckInterval time.Duration            // интервал проверки реплик
+}
+
+// ClusterStruct кластер из основного сервера и реплик
+type ClusterStruct struct {
+	primary       *ConnectionPoolItem
+	primaryKey    string
+	replicaList   []*replicaStruct
+	selectPolicy  int
+	maxLag        time.Duration
+	checkInterval time.Duration
+	counter       atomic.Uint64
+	stopChan      chan struct{}
+	stopOnce      sync.Once
+}
+
+// реплика кластера
+type replicaStruct struct {
+	host      string
+	key       string
+	pool      *ConnectionPoolItem
+	isHealthy atomic.Bool
+	latency   atomic.Int64 // задержка пинга в наносекундах
+	lag       atomic.Int64 // отставание в секундах
+}
+
+// ReplicaStatusStruct состояние реплики
+type ReplicaStatusStruct struct {
+	Host      string
+	IsHealthy bool
+	Latency   time.Duration
+	Lag       time.Duration
+}
+
+// объявляем хранилище кластеров
+var mysqlClusterList = sync.Map{}
+
+// -------------------------------------------------------
+// PUBLIC
+// -------------------------------------------------------
+
+// GetMysqlCluster получаем хранимый кластер, создавая его при первом обращении
+func GetMysqlCluster(ctx context.Context, config ClusterConfigStruct) (*ClusterStruct, error) {
+
+	primaryConfig := config.getPrimaryConfig()
+	uniqueKey := primaryConfig.Host + "-" + primaryConfig.Db
+	cluster, exist := mysqlClusterList.Load(uniqueKey)
+	if exist {
+		return cluster.(*ClusterStruct), nil
+	}
+
+	newCluster, err := createMysqlCluster(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	// кластер мог создать параллельный вызов – тогда отдаем его, а свой останавливаем
+	cluster, isLoaded := mysqlClusterList.LoadOrStore(uniqueKey, newCluster)
+	if isLoaded {
+		newCluster.stop()
+	}
+
+	return cluster.(*ClusterStruct), nil
+}
+
+// RemoveMysqlCluster останавливаем проверку реплик и убираем кластер из хранилища
+// пулы соединений остаются в хранилище пулов и закрываются через RemoveMysqlConnectionPool
+func RemoveMysqlCluster(db string, primaryHost string) {
+
+	uniqueKey := primaryHost + "-" + db
+	cluster, exist := mysqlClusterList.LoadAndDelete(uniqueKey)
+	if !exist {
+		return
+	}
+
+	cluster.(*ClusterStruct).stop()
+}
+
+// Primary получаем пул основного сервера
+func (cluster *ClusterStruct) Primary() *ConnectionPoolItem {
+
+	// пул мог быть заменен в хранилище через ReplaceConnection, отдаем актуальный
+	return getStoredConnectionPool(cluster.primaryKey, cluster.primary)
+}
+
+// Replica получаем пул для чтения, если здоровых реплик нет – основной сервер
+func (cluster *ClusterStruct) Replica() *ConnectionPoolItem {
+
+	replica := cluster.selectReplica()
+	if replica == nil {
+		return cluster.Primary()
+	}
+
+	return replica.getPool()
+}
+
+// GetReplicaStatusList получаем состояние реплик
+func (cluster *ClusterStruct) GetReplicaStatusList() []ReplicaStatusStruct {
+
+	statusList := make([]ReplicaStatusStruct, 0, len(cluster.replicaList))
+	for _, replica := range cluster.replicaList {
+
+		statusList = append(statusList, ReplicaStatusStruct{
+			Host:      replica.host,
+			IsHealthy: replica.isHealthy.Load(),
+			Latency:   time.Duration(replica.latency.Load()),
+			Lag:       time.Duration(replica.lag.Load()) * time.Second,
+		})
+	}
+
+	return statusList
+}
+
+// GetAll получаем массив из запроса с реплики
+func (cluster *ClusterStruct) GetAll(ctx context.Context, query string, args ...interface{}) (map[int]map[string]string, error) {
+
+	return cluster.getReadPool(query).GetAll(ctx, query, args...)
+}
+
+// FetchQuery получаем ответ после запроса с реплики
+func (cluster *ClusterStruct) FetchQuery(ctx context.Context, query string, args ...interface{}) (map[string]string, error) {
+
+	return cluster.getReadPool(query).FetchQuery(ctx, query, args...)
+}
+
+// FetchList получаем одномерный массив из запроса с реплики
+func (cluster *ClusterStruct) FetchList(ctx context.Context, query string, args ...interface{}) ([]string, error) {
+
+	return cluster.getReadPool(query).FetchList(ctx, query, args...)
+}
+
+// Insert осуществляем запрос вставки на основном сервере
+func (cluster *ClusterStruct) Insert(ctx context.Context, tableName string, insert map[string]interface{}, isIgnore bool) (int64, error) {
+
+	return cluster.Primary().Insert(ctx, tableName, insert, isIgnore)
+}
+
+// InsertOrUpdate осуществляем запрос insert or update на основном сервере
+func (cluster *ClusterStruct) InsertOrUpdate(ctx context.Context, tableName string, insert map[string]interface{}) error {
+
+	return cluster.Primary().InsertOrUpdate(ctx, tableName, insert)
+}
+
+// InsertArray вставляем массив записей на основном сервере
+func (cluster *ClusterStruct) InsertArray(ctx context.Context, tableName string, columnList []string, insertDataList [][]interface{}) error {
+
+	return cluster.Primary().InsertArray(ctx, tableName, columnList, insertDataList)
+}
+
+// Update осуществляем запрос update на основном сервере
+func (cluster *ClusterStruct) Update(ctx context.Context, query string, args ...interface{}) (int64, error) {
+
+	return cluster.Primary().Update(ctx, query, args...)
+}
+
+// Query осуществляем запрос на основном сервере
+func (cluster *ClusterStruct) Query(ctx context.Context, query string, args ...interface{}) error {
+
+	return cluster.Primary().Query(ctx, query, args...)
+}
+
+// BeginTransaction начинаем транзакцию на основном сервере
+func (cluster *ClusterStruct) BeginTransaction() (TransactionStruct, error) {
+
+	return cluster.Primary().BeginTransaction()
+}
+
+// BeginTransactionContext начинаем транзакцию с контекстом на основном сервере
+func (cluster *ClusterStruct) BeginTransactionContext(ctx context.Context, opts *sql.TxOptions) (TransactionStruct, error) {
+
+	return cluster.Primary().BeginTransactionContext(ctx, opts)
+}
+
+// RunInTransaction выполняем функцию в транзакции на основном сервере
+func (cluster *ClusterStruct) RunInTransaction(ctx context.Context, opts *sql.TxOptions, callback func(transactionItem *TransactionStruct) error) error {
+
+	return cluster.Primary().RunInTransaction(ctx, opts, callback)
+}
+
+// -------------------------------------------------------
+// PROTECTED
+// -------------------------------------------------------
+
+// создаем кластер и запускаем проверку реплик
+func createMysqlCluster(ctx context.Context, config ClusterConfigStruct) (*ClusterStruct, error) {
+
+	primaryConfig := config.getPrimaryConfig()
+	primary, err := GetMysqlConnectionWithConfig(ctx, primaryConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	cluster := &ClusterStruct{
+		primary:       primary,
+		primaryKey:    primaryConfig.Host + "-" + primaryConfig.Db,
+		selectPolicy:  config.SelectPolicy,
+		maxLag:        config.MaxReplicationLag,
+		checkInterval: config.HealthCheckInterval,
+		stopChan:      make(chan struct{}),
+	}
+
+	if cluster.selectPolicy != ReplicaSelectLeastLatency {
+		cluster.selectPolicy = ReplicaSelectRoundRobin
+	}
+	if cluster.maxLag <= 0 {
+		cluster.maxLag = defaultMaxReplicationLag
+	}
+	if cluster.checkInterval <= 0 {
+		cluster.checkInterval = defaultClusterCheckInterval
+	}
+
+	for _, replicaConfig := range config.getReplicaConfigList() {
+
+		// пул открывается без подключения, поэтому недоступная при старте реплика не ошибка – она войдет в ротацию после проверки
+		// ошибку дает только некорректная конфигурация
+		pool, err := getReplicaConnectionPool(replicaConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		cluster.replicaList = append(cluster.replicaList, &replicaStruct{
+			host: replicaConfig.Host,
+			key:  replicaConfig.Host + "-" + replicaConfig.Db,
+			pool: pool,
+		})
+	}
+
+	// первая проверка синхронно, чтобы сразу знать здоровые реплики
+	cluster.checkReplicaList(ctx)
+	go cluster.listenHealthCheck()
+
+	return cluster, nil
+}
+
+// получаем конфигурацию основного сервера
+func (config ClusterConfigStruct) getPrimaryConfig() ConnectionConfigStruct {
+
+	if config.Primary != nil {
+		return *config.Primary
+	}
+
+	return NewConnectionConfig(config.Db, config.PrimaryHost, config.User, config.Pass, config.MaxConnections, config.IsSsl)
+}
+
+// получаем конфигурации реплик: сначала заданные хостами, затем полные
+func (config ClusterConfigStruct) getReplicaConfigList() []ConnectionConfigStruct {
+
+	replicaConfigList := make([]ConnectionConfigStruct, 0, len(config.ReplicaHostList)+len(config.ReplicaList))
+	for _, host := range config.ReplicaHostList {
+		replicaConfigList = append(replicaConfigList, NewConnectionConfig(config.Db, host, config.User, config.Pass, config.MaxConnections, config.IsSsl))
+	}
+
+	return append(replicaConfigList, config.ReplicaList...)
+}
+
+// получаем пул реплики, без проверки доступности
+func getReplicaConnectionPool(config ConnectionConfigStruct) (*ConnectionPoolItem, error) {
+
+	uniqueKey := config.Host + "-" + config.Db
+	if item, exist := mysqlConnectionPoolList.Load(uniqueKey); exist {
+		return item.(*ConnectionPoolItem), nil
+	}
+
+	pool, err := openMysqlConnectionPool(config)
+	if err != nil {
+
+		log.Errorf("error when creating replica connection pool `%s` on %s, err: %s", config.Db, config.Host, err.Error())
+		return nil, err
+	}
+
+	item, isLoaded := mysqlConnectionPoolList.LoadOrStore(uniqueKey, pool)
+	if isLoaded {
+		_ = pool.Close()
+	}
+
+	return item.(*ConnectionPoolItem), nil
+}
+
+// получаем пул для чтения, блокирующее чтение выполняем на основном сервере – реплика не блокирует строки основного
+func (cluster *ClusterStruct) getReadPool(query string) *ConnectionPoolItem {
+
+	if isLockingRead(query) {
+		return cluster.Primary()
+	}
+
+	return cluster.Replica()
+}
+
+// выбираем здоровую реплику
+func (cluster *ClusterStruct) selectReplica() *replicaStruct {
+
+	healthyList := make([]*replicaStruct, 0, len(cluster.replicaList))
+	for _, replica := range cluster.replicaList {
+
+		if replica.isHealthy.Load() {
+			healthyList = append(healthyList, replica)
+		}
+	}
+
+	if len(healthyList) == 0 {
+		return nil
+	}
+
+	if cluster.selectPolicy == ReplicaSelectLeastLatency {
+
+		selected := healthyList[0]
+		for _, replica := range healthyList[1:] {
+
+			if replica.latency.Load() < selected.latency.Load() {
+				selected = replica
+			}
+		}
+		return selected
+	}
+
+	index := cluster.counter.Add(1) % uint64(len(healthyList))
+	return healthyList[index]
+}
+
+// периодически проверяем реплики
+func (cluster *ClusterStruct) listenHealthCheck() {
+
+	ticker := time.NewTicker(cluster.checkInterval)
+	defer ticker.Stop()
+
+	for {
+
+		select {
+		case <-cluster.stopChan:
+			return
+		case <-ticker.C:
+			cluster.checkReplicaList(context.Background())
+		}
+	}
+}
+
+// проверяем все реплики
+func (cluster *ClusterStruct) checkReplicaList(ctx context.Context) {
+
+	for _, replica := range cluster.replicaList {
+
+		isHealthy := cluster.checkReplica(ctx, replica)
+
+		// логируем только смену состояния
+		if replica.isHealthy.Swap(isHealthy) != isHealthy {
+
+			if isHealthy {
+				log.Infof("replica %s returned to rotation", replica.host)
+			} else {
+				log.Warningf("replica %s removed from rotation", replica.host)
+			}
+		}
+	}
+}
+
+// проверяем доступность и отставание реплики
+func (cluster *ClusterStruct) checkReplica(ctx context.Context, replica *replicaStruct) bool {
+
+	pingCtx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+
+	startAt := time.Now()
+	err := replica.getPool().GetConnectionPool().PingContext(pingCtx)
+	if err != nil {
+		return false
+	}
+	replica.latency.Store(int64(time.Since(startAt)))
+
+	lag, err := getReplicationLag(ctx, replica.getPool())
+	if err != nil {
+
+		log.Errorf("unable get replication lag on %s, error: %v", replica.host, err)
+		return false
+	}
+	replica.lag.Store(int64(lag / time.Second))
+
+	return lag <= cluster.maxLag
+}
+
+// получаем отставание реплики, пустой ответ – сервер не является репликой, и это ошибка
+// запрос идет напрямую в пул: проверка не должна повторяться, вызывать хуки и попадать в журнал медленных запросов
+func getReplicationLag(ctx context.Context, pool *ConnectionPoolItem) (time.Duration, error) {
+
+	queryCtx, cancel := pool.withQueryTimeout(ctx)
+	defer cancel()
+
+	// SHOW REPLICA STATUS есть начиная с MySQL 8.0.22, для старых версий – SHOW SLAVE STATUS
+	status, err := getReplicaStatus(queryCtx, pool.GetConnectionPool(), "SHOW REPLICA STATUS")
+	if err != nil {
+		status, err = getReplicaStatus(queryCtx, pool.GetConnectionPool(), "SHOW SLAVE STATUS")
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// репликация сброшена или хост указан по ошибке – читать с него нельзя
+	if len(status) == 0 {
+		return 0, fmt.Errorf("server is not a replica")
+	}
+
+	lag, exist := status["Seconds_Behind_Source"]
+	if !exist {
+		lag, exist = status["Seconds_Behind_Master"]
+	}
+
+	// NULL означает, что репликация остановлена
+	if !exist || !lag.Valid {
+		return 0, fmt.Errorf("replication is not running")
+	}
+
+	return time.Duration(functions.StringToInt64(lag.String)) * time.Second, nil
+}
+
+// получаем первую строку статуса репликации, колонки зависят от версии сервера
+func getReplicaStatus(ctx context.Context, pool *sql.DB, query string) (map[string]sql.NullString, error) {
+
+	rows, err := pool.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	columnList, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	status := make(map[string]sql.NullString, len(columnList))
+	if !rows.Next() {
+		return status, rows.Err()
+	}
+
+	valueList := make([]sql.NullString, len(columnList))
+	scanList := make([]interface{}, len(valueList))
+	for i := range valueList {
+		scanList[i] = &valueList[i]
+	}
+
+	err = rows.Scan(scanList...)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, column := range columnList {
+		status[column] = valueList[i]
+	}
+
+	return status, nil
+}
+
+// останавливаем проверку реплик
+func (cluster *ClusterStruct) stop() {
+
+	cluster.stopOnce.Do(func() {
+		close(cluster.stopChan)
+	})
+}
+
+// осуществляем запрос на чтение через реплику, чтобы кластер можно было передавать в FetchOne/FetchAll
+func (cluster *ClusterStruct) sendQueryForFormat(ctx context.Context, query string, args ...interface{}) (*queryStruct, error) {
+
+	return cluster.getReadPool(query).sendQueryForFormat(ctx, query, args...)
+}
+
+// ограничиваем контекст запроса таймаутом основного сервера
+func (cluster *ClusterStruct) withQueryTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+
+	return cluster.Primary().withQueryTimeout(ctx)
+}
+
+// получаем актуальный пул реплики, он мог быть заменен в хранилище через ReplaceConnection
+func (replica *replicaStruct) getPool() *ConnectionPoolItem {
+
+	return getStoredConnectionPool(replica.key, replica.pool)
+}
@@ -0,0 +1,70 @@
+package mysql
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	sqlmock "github.com/getCompassUtils/go_base_frame/api/_modules/go-sqlmock"
+)
+
+// проверяем, что узлы кластера можно задать полной конфигурацией
+func TestClusterConfigNodeList(t *testing.T) {
+
+	config := ClusterConfigStruct{
+		Db:              "company",
+		PrimaryHost:     "mysql-1",
+		ReplicaHostList: []string{"mysql-2"},
+		ReplicaList:     []ConnectionConfigStruct{{Db: "company", Host: "mysql-3", Tls: &TlsConfigStruct{CaFile: "ca.pem"}}},
+	}
+
+	if primaryConfig := config.getPrimaryConfig(); primaryConfig.Host != "mysql-1" || primaryConfig.Db != "company" {
+		t.Fatalf("primary config = %+v", primaryConfig)
+	}
+
+	replicaConfigList := config.getReplicaConfigList()
+	if len(replicaConfigList) != 2 || replicaConfigList[0].Host != "mysql-2" || replicaConfigList[1].Tls == nil {
+		t.Fatalf("replica config list = %+v", replicaConfigList)
+	}
+
+	config.Primary = &ConnectionConfigStruct{Db: "company", Host: "mysql-0", MaxIdleConnections: 5}
+	if primaryConfig := config.getPrimaryConfig(); primaryConfig.Host != "mysql-0" || primaryConfig.MaxIdleConnections != 5 {
+		t.Fatalf("primary config = %+v", primaryConfig)
+	}
+}
+
+// проверяем, что на старых версиях отставание читается через SHOW SLAVE STATUS
+func TestGetReplicationLag(t *testing.T) {
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("unable create sqlmock: %v", err)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	mock.ExpectQuery("SHOW REPLICA STATUS").WillReturnError(errors.New("You have an error in your SQL syntax"))
+	mock.ExpectQuery("SHOW SLAVE STATUS").WillReturnRows(sqlmock.NewRows([]string{"Slave_IO_State", "Seconds_Behind_Master"}).AddRow("Waiting", "3"))
+
+	pool := &ConnectionPoolItem{ConnectionPool: db}
+	lag, err := getReplicationLag(context.Background(), pool)
+	if err != nil || lag != 3*time.Second {
+		t.Fatalf("lag = %v, err = %v, want 3s", lag, err)
+	}
+
+	mock.ExpectQuery("SHOW REPLICA STATUS").WillReturnRows(sqlmock.NewRows([]string{"Replica_IO_State", "Seconds_Behind_Source"}).AddRow("Waiting", nil))
+	if _, err = getReplicationLag(context.Background(), pool); err == nil {
+		t.Fatalf("expected error for stopped replication")
+	}
+
+	mock.ExpectQuery("SHOW REPLICA STATUS").WillReturnRows(sqlmock.NewRows([]string{"Replica_IO_State"}))
+	if _, err = getReplicationLag(context.Background(), pool); err == nil {
+		t.Fatalf("expected error for server that is not a replica")
+	}
+
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+package mysql
+
+import (
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+)
+
+// -------------------------------------------------------
+// конфигурация пула соединений
+// параметры пула и строки подключения, включая проверку сертификатов сервера
+// -------------------------------------------------------
+
+const defaultConnMaxLifetime = time.Minute // время жизни соединения по умолчанию, как было раньше
+
+// ConnectionConfigStruct конфигурация пула соединений
+// нулевые значения сохраняют прежнее поведение пакета
+type ConnectionConfigStruct struct {
+	Db                 string           // база данных
+	Host               string           // хост с портом
+	User               string           // пользователь
+	Pass               string           // пароль
+	MaxConnections     int              // максимальное количество открытых соединений
+	MaxIdleConnections int              // максимальное количество простаивающих соединений, 0 – равно MaxConnections
+	ConnMaxLifetime    time.Duration    // время жизни соединения, 0 – одна минута
+	ConnMaxIdleTime    time.Duration    // время простоя соединения до закрытия, 0 – без ограничения
+	Charset            string           // кодировка соединения, например utf8mb4
+	Collation          string           // сравнение соединения, например utf8mb4_unicode_ci
+	IsParseTime        bool             // отдавать DATE и DATETIME как time.Time
+	Loc                *time.Location   // часовой пояс для time.Time, nil – UTC
+	DialTimeout        time.Duration    // таймаут установки соединения
+	ReadTimeout        time.Duration    // таймаут чтения
+	WriteTimeout       time.Duration    // таймаут записи
+	IsSsl              bool             // использовать ssl без проверки сертификата, если не задан Tls
+	Tls                *TlsConfigStruct // ssl с проверкой сертификата сервера
+}
+
+// TlsConfigStruct настройки ssl соединения
+type TlsConfigStruct struct {
+	CaFile       string // файл с сертификатом CA, которым проверяется сертификат сервера
+	CertFile     string // файл с сертификатом клиента, если сервер его требует
+	KeyFile      string // файл с ключом клиента
+	ServerName   string // имя сервера в сертификате, если отличается от хоста
+	IsSkipVerify bool   // не проверять сертификат сервера
+}
+
+// -------------------------------------------------------
+// PUBLIC
+// -------------------------------------------------------
+
+// NewConnectionConfig создаем конфигурацию с прежними параметрами функций подключения
+func NewConnectionConfig(db string, host string, user string, pass string, maxConnections int, isSsl bool) ConnectionConfigStruct {
+
+	return ConnectionConfigStruct{
+		Db:             db,
+		Host:           host,
+		User:           user,
+		Pass:           pass,
+		MaxConnections: maxConnections,
+		IsSsl:          isSsl,
+	}
+}
+
+// -------------------------------------------------------
+// PROTECTED
+// -------------------------------------------------------
+
+// получаем строку подключения по конфигурации
+func (config ConnectionConfigStruct) formatDsn() (string, error) {
+
+	driverConfig := mysqldriver.NewConfig()
+	driverConfig.User = config.User
+	driverConfig.Passwd = config.Pass
+	driverConfig.Net = "tcp"
+	driverConfig.Addr = config.Host
+	driverConfig.DBName = config.Db
+	driverConfig.Collation = config.Collation
+	driverConfig.ParseTime = config.IsParseTime
+	driverConfig.Timeout = config.DialTimeout
+	driverConfig.ReadTimeout = config.ReadTimeout
+	driverConfig.WriteTimeout = config.WriteTimeout
+
+	if config.Loc != nil {
+		driverConfig.Loc = config.Loc
+	}
+
+	if config.Charset != "" {
+		driverConfig.Params = map[string]string{"charset": config.Charset}
+	}
+
+	switch {
+	case config.Tls != nil:
+
+		tlsName, err := registerTlsConfig(config.Host, *config.Tls)
+		if err != nil {
+			return "", err
+		}
+		driverConfig.TLSConfig = tlsName
+	case config.IsSsl:
+		driverConfig.TLSConfig = "skip-verify"
+	}
+
+	return driverConfig.FormatDSN(), nil
+}
+
+// регистрируем настройки ssl в драйвере, имя зависит только от настроек, поэтому повторная регистрация безопасна
+func registerTlsConfig(host string, config TlsConfigStruct) (string, error) {
+
+	tlsConfig := &tls.Config{
+		ServerName:         config.ServerName,
+		InsecureSkipVerify: config.IsSkipVerify,
+	}
+
+	if config.CaFile != "" {
+
+		caContent, err := os.ReadFile(config.CaFile)
+		if err != nil {
+			return "", fmt.Errorf("unable read ca file %s, error: %w", config.CaFile, err)
+		}
+
+		certPool := x509.NewCertPool()
+		if !certPool.AppendCertsFromPEM(caContent) {
+			return "", fmt.Errorf("unable parse ca file %s", config.CaFile)
+		}
+		tlsConfig.RootCAs = certPool
+	}
+
+	if config.CertFile != "" || config.KeyFile != "" {
+
+		certificate, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return "", fmt.Errorf("unable load client certificate %s, error: %w", config.CertFile, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	tlsName := fmt.Sprintf("tls_%x", sha1.Sum([]byte(fmt.Sprintf("%s|%s|%s|%s|%s|%t",
+		host, config.CaFile, config.CertFile, config.KeyFile, config.ServerName, config.IsSkipVerify))))
+
+	err := mysqldriver.RegisterTLSConfig(tlsName, tlsConfig)
+	if err != nil {
+		return "", fmt.Errorf("unable register tls config, error: %w", err)
+	}
+
+	return tlsName, nil
+}
+
+// получаем максимальное количество простаивающих соединений
+func (config ConnectionConfigStruct) getMaxIdleConnections() int {
+
+	if config.MaxIdleConnections > 0 {
+		return config.MaxIdleConnections
+	}
+
+	return config.MaxConnections
+}
+
+// получаем время жизни соединения
+func (config ConnectionConfigStruct) getConnMaxLifetime() time.Duration {
+
+	if config.ConnMaxLifetime > 0 {
+		return config.ConnMaxLifetime
+	}
+
+	return defaultConnMaxLifetime
+}
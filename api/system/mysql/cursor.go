@@ -0,0 +1,161 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+)
+
+// -------------------------------------------------------
+// построчное чтение больших ответов
+// курсор переиспользует буферы колонок и сканирования из sendQueryForFormat,
+// поэтому потребление памяти не зависит от количества строк
+// -------------------------------------------------------
+
+// CursorStruct курсор для построчного чтения ответа
+type CursorStruct struct {
+	queryItem *queryStruct
+	query     string
+	isClosed  bool
+}
+
+// -------------------------------------------------------
+// PUBLIC
+// -------------------------------------------------------
+
+// OpenCursor открываем курсор по запросу
+// таймаут QueryTimeout не применяется, время чтения ограничивается только ctx
+// курсор обязательно закрыть через Close
+func (connectionItem *ConnectionPoolItem) OpenCursor(ctx context.Context, query string, args ...interface{}) (*CursorStruct, error) {
+
+	return openCursor(ctx, connectionItem, query, args...)
+}
+
+// EachRow вызываем callback для каждой строки ответа
+// чтение останавливается на первой ошибке callback или при отмене ctx
+func (connectionItem *ConnectionPoolItem) EachRow(ctx context.Context, callback func(cursor *CursorStruct) error, query string, args ...interface{}) error {
+
+	return eachRow(ctx, connectionItem, callback, query, args...)
+}
+
+// OpenCursor открываем курсор по запросу в транзакции
+func (transactionItem *TransactionStruct) OpenCursor(ctx context.Context, query string, args ...interface{}) (*CursorStruct, error) {
+
+	return openCursor(ctx, transactionItem, query, args...)
+}
+
+// EachRow вызываем callback для каждой строки ответа в транзакции
+func (transactionItem *TransactionStruct) EachRow(ctx context.Context, callback func(cursor *CursorStruct) error, query string, args ...interface{}) error {
+
+	return eachRow(ctx, transactionItem, callback, query, args...)
+}
+
+// Next переходим к следующей строке, false – строки закончились или произошла ошибка
+func (cursor *CursorStruct) Next() bool {
+
+	if cursor.isClosed || cursor.queryItem.rows == nil {
+		return false
+	}
+
+	if !cursor.queryItem.rows.Next() {
+
+		cursor.queryItem.handleError(cursor.queryItem.rows.Err())
+		return false
+	}
+
+	// сканируем строку в общие буферы
+	cursor.queryItem.handleError(cursor.queryItem.rows.Scan(cursor.queryItem.scanList...))
+	return cursor.queryItem.err == nil
+}
+
+// Row получаем текущую строку
+func (cursor *CursorStruct) Row() map[string]string {
+
+	rowArray := make(map[string]string, len(cursor.queryItem.valueList))
+	for key, value := range cursor.queryItem.valueList {
+		rowArray[cursor.queryItem.columnList[key]] = string(value)
+	}
+
+	return rowArray
+}
+
+// RowTyped получаем текущую строку, сохраняя NULL и тип колонок
+func (cursor *CursorStruct) RowTyped() map[string]ValueStruct {
+
+	return cursor.queryItem.getTypedRow()
+}
+
+// Scan раскладываем текущую строку по полям структуры с тегом sqlname
+func (cursor *CursorStruct) Scan(dest interface{}) error {
+
+	err := cursor.queryItem.assignRow(dest)
+	if err != nil {
+		return fmt.Errorf("unable scan row, query: '%s', error: %v", cursor.query, err)
+	}
+
+	return nil
+}
+
+// Columns получаем список колонок ответа
+func (cursor *CursorStruct) Columns() []string {
+
+	return cursor.queryItem.columnList
+}
+
+// Err получаем ошибку, прервавшую чтение
+func (cursor *CursorStruct) Err() error {
+
+	return cursor.queryItem.err
+}
+
+// Close закрываем курсор, повторный вызов ничего не делает
+func (cursor *CursorStruct) Close() error {
+
+	if cursor.isClosed || cursor.queryItem.rows == nil {
+		return nil
+	}
+
+	cursor.isClosed = true
+	return cursor.queryItem.rows.Close()
+}
+
+// -------------------------------------------------------
+// PROTECTED
+// -------------------------------------------------------
+
+// открываем курсор
+func openCursor(ctx context.Context, executor QueryExecutor, query string, args ...interface{}) (*CursorStruct, error) {
+
+	// осуществляем запрос
+	queryItem, err := executor.sendQueryForFormat(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CursorStruct{queryItem: queryItem, query: query}, nil
+}
+
+// проходим по всем строкам курсора
+func eachRow(ctx context.Context, executor QueryExecutor, callback func(cursor *CursorStruct) error, query string, args ...interface{}) error {
+
+	cursor, err := openCursor(ctx, executor, query, args...)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = cursor.Close()
+	}()
+
+	for cursor.Next() {
+
+		err = callback(cursor)
+		if err != nil {
+			return err
+		}
+	}
+
+	if cursor.Err() != nil {
+		return fmt.Errorf("unable read rows, query: '%s', error: %w", query, cursor.Err())
+	}
+
+	return nil
+}
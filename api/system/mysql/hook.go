@@ -0,0 +1,201 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// -------------------------------------------------------
+// хуки для наблюдения за запросами
+// вызываются для каждого запроса пула и транзакции,
+// поверх них строятся логирование медленных запросов, метрики и трейсинг
+// -------------------------------------------------------
+
+// QueryEventStruct событие запроса, передаваемое в хуки
+type QueryEventStruct struct {
+	DbKey         string        // база данных пула
+	Query         string        // текст запроса
+	ArgsCount     int           // количество аргументов
+	IsTransaction bool          // выполняется ли запрос в транзакции
+	StartAt       time.Time     // время начала запроса
+	Duration      time.Duration // длительность, заполняется перед AfterQuery
+	RowsAffected  int64         // количество измененных строк, -1 для запросов на чтение
+	Err           error         // ошибка запроса, заполняется перед AfterQuery
+
+	argList []interface{} // аргументы запроса, нужны для EXPLAIN медленных запросов
+}
+
+// QueryHookInterface хук запросов
+// BeforeQuery может вернуть новый контекст, например со span трейсинга, он будет передан в запрос и AfterQuery
+// для запросов на чтение AfterQuery вызывается, когда сервер начал отдавать строки, а не после их чтения
+type QueryHookInterface interface {
+	BeforeQuery(ctx context.Context, event *QueryEventStruct) context.Context
+	AfterQuery(ctx context.Context, event *QueryEventStruct)
+}
+
+// список хуков, изменяется копированием, чтобы чтение обходилось без блокировок
+type hookListStruct struct {
+	list atomic.Pointer[[]QueryHookInterface]
+	mu   sync.Mutex
+}
+
+// глобальные хуки, вызываются для всех пулов
+var globalHookList = hookListStruct{}
+
+// -------------------------------------------------------
+// PUBLIC
+// -------------------------------------------------------
+
+// RegisterGlobalQueryHook регистрируем хук для всех пулов
+func RegisterGlobalQueryHook(hook QueryHookInterface) {
+
+	globalHookList.add(hook)
+}
+
+// AddQueryHook регистрируем хук для пула, транзакции пула тоже вызывают его
+func (connectionItem *ConnectionPoolItem) AddQueryHook(hook QueryHookInterface) {
+
+	connectionItem.hookList.add(hook)
+}
+
+// -------------------------------------------------------
+// PROTECTED
+// -------------------------------------------------------
+
+// добавляем хук в список
+func (hookList *hookListStruct) add(hook QueryHookInterface) {
+
+	hookList.mu.Lock()
+	defer hookList.mu.Unlock()
+
+	newList := append(hookList.get(), hook)
+	hookList.list.Store(&newList)
+}
+
+// получаем копию списка хуков
+func (hookList *hookListStruct) get() []QueryHookInterface {
+
+	list := hookList.list.Load()
+	if list == nil {
+		return nil
+	}
+
+	return append([]QueryHookInterface{}, *list...)
+}
+
+// получаем хуки для запроса: глобальные и хуки пула
+func getQueryHookList(connectionItem *ConnectionPoolItem) []QueryHookInterface {
+
+	hookList := globalHookList.get()
+	if connectionItem != nil {
+		hookList = append(hookList, connectionItem.hookList.get()...)
+	}
+
+	return hookList
+}
+
+// выполняем запрос, вызывая хуки до и после него
+func runWithHooks[R any](ctx context.Context, hookList []QueryHookInterface, event *QueryEventStruct, call func(ctx context.Context) (R, error), getRowsAffected func(result R) int64) (R, error) {
+
+	if len(hookList) == 0 {
+		return call(ctx)
+	}
+
+	for _, hook := range hookList {
+		ctx = hook.BeforeQuery(ctx, event)
+	}
+
+	event.StartAt = time.Now()
+	result, err := call(ctx)
+	event.Duration = time.Since(event.StartAt)
+	event.Err = err
+
+	event.RowsAffected = -1
+	if err == nil && getRowsAffected != nil {
+		event.RowsAffected = getRowsAffected(result)
+	}
+
+	for _, hook := range hookList {
+		hook.AfterQuery(ctx, event)
+	}
+
+	return result, err
+}
+
+// получаем количество измененных строк из результата
+func getResultRowsAffected(result sql.Result) int64 {
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return -1
+	}
+
+	return rowsAffected
+}
+
+// выполняем запрос на изменение через пул
+func (connectionItem *ConnectionPoolItem) execContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+
+	event := &QueryEventStruct{DbKey: connectionItem.dbKey, Query: query, ArgsCount: len(args), argList: args}
+	result, err := runWithHooks(ctx, getQueryHookList(connectionItem), event, func(ctx context.Context) (sql.Result, error) {
+		return connectionItem.execWithCache(ctx, query, args...)
+	}, getResultRowsAffected)
+
+	// запись прошла – сбрасываем кэш ответов по измененным таблицам
+	if err == nil {
+		connectionItem.invalidateQueryCache(query)
+	}
+
+	return result, err
+}
+
+// выполняем запрос на чтение через пул
+func (connectionItem *ConnectionPoolItem) queryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+
+	event := &QueryEventStruct{DbKey: connectionItem.dbKey, Query: query, ArgsCount: len(args), argList: args}
+	return runWithHooks(ctx, getQueryHookList(connectionItem), event, func(ctx context.Context) (*sql.Rows, error) {
+		return connectionItem.queryWithCache(ctx, query, args...)
+	}, nil)
+}
+
+// выполняем запрос на изменение в транзакции
+func (transactionItem *TransactionStruct) execContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+
+	event := &QueryEventStruct{DbKey: transactionItem.dbKey, Query: query, ArgsCount: len(args), argList: args, IsTransaction: true}
+	result, err := runWithHooks(ctx, getQueryHookList(transactionItem.connectionItem), event, func(ctx context.Context) (sql.Result, error) {
+		return transactionItem.transaction.ExecContext(ctx, query, args...)
+	}, getResultRowsAffected)
+
+	if err == nil {
+		transactionItem.rememberWriteQuery(query)
+	}
+
+	return result, err
+}
+
+// выполняем подготовленный запрос в транзакции
+func (transactionItem *TransactionStruct) execStatementContext(ctx context.Context, stmt *sql.Stmt, query string, args ...interface{}) (sql.Result, error) {
+
+	event := &QueryEventStruct{DbKey: transactionItem.dbKey, Query: query, ArgsCount: len(args), argList: args, IsTransaction: true}
+	result, err := runWithHooks(ctx, getQueryHookList(transactionItem.connectionItem), event, func(ctx context.Context) (sql.Result, error) {
+		return stmt.ExecContext(ctx, args...)
+	}, getResultRowsAffected)
+
+	if err == nil {
+		transactionItem.rememberWriteQuery(query)
+	}
+
+	return result, err
+}
+
+// выполняем запрос на чтение в транзакции
+func (transactionItem *TransactionStruct) queryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+
+	event := &QueryEventStruct{DbKey: transactionItem.dbKey, Query: query, ArgsCount: len(args), argList: args, IsTransaction: true}
+	return runWithHooks(ctx, getQueryHookList(transactionItem.connectionItem), event, func(ctx context.Context) (*sql.Rows, error) {
+		return transactionItem.transaction.QueryContext(ctx, query, args...)
+	}, nil)
+}
@@ -0,0 +1,259 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/getCompassUtils/go_base_frame/api/system/log"
+)
+
+// -------------------------------------------------------
+// именованные блокировки через GET_LOCK
+// блокировка принадлежит соединению, поэтому под нее выделяется отдельное соединение пула,
+// которое живет до освобождения; при обрыве соединения mysql отпускает блокировку сама,
+// а фоновая проверка отмечает блокировку потерянной
+// -------------------------------------------------------
+
+const (
+	lockCheckInterval = 5 * time.Second // как часто проверяем, что блокировка все еще наша
+	maxLockNameLength = 64              // ограничение mysql на длину имени блокировки
+)
+
+// ErrLockNotAcquired блокировку держит другое соединение
+var ErrLockNotAcquired = errors.New("lock is held by another connection")
+
+// ErrLockLost соединение с блокировкой оборвалось или блокировка уже не наша
+var ErrLockLost = errors.New("lock is lost")
+
+// LockStruct взятая блокировка
+type LockStruct struct {
+	name           string
+	conn           *sql.Conn
+	connectionItem *ConnectionPoolItem
+	mu             sync.Mutex
+	isClosed       bool          // блокировка освобождена или потеряна
+	lostChan       chan struct{} // закрывается при потере блокировки
+	stopChan       chan struct{} // закрывается при освобождении, останавливает проверку
+}
+
+// -------------------------------------------------------
+// PUBLIC
+// -------------------------------------------------------
+
+// Lock берем блокировку, ожидая ее не дольше timeout, timeout < 0 – ждем, пока не отменят контекст
+// если дождаться не удалось – возвращаем ErrLockNotAcquired
+func (connectionItem *ConnectionPoolItem) Lock(ctx context.Context, name string, timeout time.Duration) (*LockStruct, error) {
+
+	// mysql принимает ожидание в целых секундах, округляем вверх
+	timeoutSeconds := -1
+	if timeout >= 0 {
+		timeoutSeconds = int(math.Ceil(timeout.Seconds()))
+	}
+
+	return connectionItem.getLock(ctx, name, timeoutSeconds)
+}
+
+// TryLock берем блокировку без ожидания, если ее держат – возвращаем ErrLockNotAcquired
+func (connectionItem *ConnectionPoolItem) TryLock(ctx context.Context, name string) (*LockStruct, error) {
+
+	return connectionItem.getLock(ctx, name, 0)
+}
+
+// RunLocked выполняем функцию под блокировкой, контекст функции отменяется при потере блокировки
+// если блокировку потеряли во время выполнения – возвращаем ErrLockLost
+func (connectionItem *ConnectionPoolItem) RunLocked(ctx context.Context, name string, timeout time.Duration, callback func(ctx context.Context) error) error {
+
+	lock, err := connectionItem.Lock(ctx, name, timeout)
+	if err != nil {
+		return err
+	}
+
+	lockCtx, cancel := lock.WithContext(ctx)
+	defer cancel()
+
+	err = callback(lockCtx)
+	releaseErr := lock.Release()
+	if err != nil {
+		return err
+	}
+
+	return releaseErr
+}
+
+// Name имя блокировки
+func (lock *LockStruct) Name() string {
+
+	return lock.name
+}
+
+// Lost канал, который закрывается при потере блокировки
+func (lock *LockStruct) Lost() <-chan struct{} {
+
+	return lock.lostChan
+}
+
+// IsLost потеряна ли блокировка
+func (lock *LockStruct) IsLost() bool {
+
+	select {
+	case <-lock.lostChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// WithContext получаем контекст, который отменяется при потере блокировки
+func (lock *LockStruct) WithContext(ctx context.Context) (context.Context, context.CancelFunc) {
+
+	lockCtx, cancel := context.WithCancel(ctx)
+	go func() {
+
+		select {
+		case <-lock.lostChan:
+			cancel()
+		case <-lockCtx.Done():
+		}
+	}()
+
+	return lockCtx, cancel
+}
+
+// Release освобождаем блокировку и возвращаем соединение в пул
+// если блокировка была потеряна – возвращаем ErrLockLost, повторное освобождение ничего не делает
+func (lock *LockStruct) Release() error {
+
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+
+	if lock.isClosed {
+
+		if lock.IsLost() {
+			return ErrLockLost
+		}
+		return nil
+	}
+
+	lock.isClosed = true
+	close(lock.stopChan)
+	defer func() {
+		_ = lock.conn.Close()
+	}()
+
+	// контекст вызывающего мог уже закончиться, а блокировку нужно отпустить
+	ctx, cancel := context.WithTimeout(context.Background(), lock.connectionItem.getQueryTimeout())
+	defer cancel()
+
+	var isReleased sql.NullInt64
+	err := lock.conn.QueryRowContext(ctx, "SELECT RELEASE_LOCK(?)", lock.name).Scan(&isReleased)
+	if err != nil {
+		return fmt.Errorf("unable release lock %s, error: %w", lock.name, err)
+	}
+
+	if isReleased.Int64 != 1 {
+
+		close(lock.lostChan)
+		return ErrLockLost
+	}
+
+	return nil
+}
+
+// -------------------------------------------------------
+// PROTECTED
+// -------------------------------------------------------
+
+// берем блокировку на выделенном соединении
+func (connectionItem *ConnectionPoolItem) getLock(ctx context.Context, name string, timeoutSeconds int) (*LockStruct, error) {
+
+	if name == "" || len(name) > maxLockNameLength {
+		return nil, fmt.Errorf("lock name must be from 1 to %d characters, got %q", maxLockNameLength, name)
+	}
+
+	conn, err := connectionItem.GetConnectionPool().Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable get connection for lock %s, error: %w", name, err)
+	}
+
+	// таймаут запросов пула не применяем – ожидание ограничено timeoutSeconds и контекстом
+	var isLocked sql.NullInt64
+	err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", name, timeoutSeconds).Scan(&isLocked)
+	if err != nil {
+
+		_ = conn.Close()
+		return nil, fmt.Errorf("unable get lock %s, error: %w", name, err)
+	}
+
+	if isLocked.Int64 != 1 {
+
+		_ = conn.Close()
+		return nil, ErrLockNotAcquired
+	}
+
+	lock := &LockStruct{
+		name:           name,
+		conn:           conn,
+		connectionItem: connectionItem,
+		lostChan:       make(chan struct{}),
+		stopChan:       make(chan struct{}),
+	}
+	go lock.watch()
+
+	return lock, nil
+}
+
+// периодически проверяем, что блокировка все еще наша
+func (lock *LockStruct) watch() {
+
+	ticker := time.NewTicker(lockCheckInterval)
+	defer ticker.Stop()
+
+	for {
+
+		select {
+		case <-lock.stopChan:
+			return
+		case <-ticker.C:
+
+			if !lock.check() {
+				return
+			}
+		}
+	}
+}
+
+// проверяем блокировку, при потере закрываем соединение – mysql отпустит блокировку, если она еще держится
+func (lock *LockStruct) check() bool {
+
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+
+	if lock.isClosed {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), lock.connectionItem.getQueryTimeout())
+	defer cancel()
+
+	var isOwner sql.NullInt64
+	err := lock.conn.QueryRowContext(ctx, "SELECT IS_USED_LOCK(?) = CONNECTION_ID()", lock.name).Scan(&isOwner)
+	if err == nil && isOwner.Int64 == 1 {
+		return true
+	}
+
+	if err != nil {
+		log.Errorf("lock %s is lost, error: %v", lock.name, err)
+	} else {
+		log.Errorf("lock %s is lost, it is no longer held by this connection", lock.name)
+	}
+
+	lock.isClosed = true
+	close(lock.lostChan)
+	_ = lock.conn.Close()
+	return false
+}
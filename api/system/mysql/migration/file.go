@@ -0,0 +1,189 @@
+package migration
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/getCompassUtils/go_base_frame/api/system/fileutils"
+)
+
+// -------------------------------------------------------
+// чтение файлов миграций
+// -------------------------------------------------------
+
+// имя файла миграции: версия, имя и направление
+var migrationFileRegex = regexp.MustCompile(`^(\d+)_([a-zA-Z0-9_\-]+)\.(up|down)\.sql$`)
+
+// файлы одной версии миграции
+type migrationFileStruct struct {
+	version  int64
+	name     string
+	upPath   string // путь относительно рабочей директории
+	downPath string // путь относительно рабочей директории, пустой – откат не предусмотрен
+}
+
+// -------------------------------------------------------
+// PROTECTED
+// -------------------------------------------------------
+
+// получаем миграции базы, отсортированные по версии
+func readMigrationFileList(workDir string, dir string, db string) ([]migrationFileStruct, error) {
+
+	dbDir := filepath.Join(dir, db)
+	file, err := fileutils.Init(workDir, dbDir)
+	if err != nil {
+		return nil, fmt.Errorf("unable open migration dir %s, error: %w", dbDir, err)
+	}
+
+	entryList, err := os.ReadDir(file.GetPath())
+	if err != nil {
+		return nil, fmt.Errorf("unable read migration dir %s, error: %w", dbDir, err)
+	}
+
+	fileMap := make(map[int64]*migrationFileStruct)
+	for _, entry := range entryList {
+
+		match := migrationFileRegex.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s, error: %w", entry.Name(), err)
+		}
+
+		migrationFile, exist := fileMap[version]
+		if !exist {
+
+			migrationFile = &migrationFileStruct{version: version, name: match[2]}
+			fileMap[version] = migrationFile
+		}
+
+		if migrationFile.name != match[2] {
+			return nil, fmt.Errorf("migration version %d has different names: %s and %s", version, migrationFile.name, match[2])
+		}
+
+		path := filepath.Join(dbDir, entry.Name())
+		if match[3] == "up" {
+			migrationFile.upPath = path
+		} else {
+			migrationFile.downPath = path
+		}
+	}
+
+	fileList := make([]migrationFileStruct, 0, len(fileMap))
+	for _, migrationFile := range fileMap {
+
+		if migrationFile.upPath == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", migrationFile.version, migrationFile.name)
+		}
+		fileList = append(fileList, *migrationFile)
+	}
+
+	sort.Slice(fileList, func(i, j int) bool {
+		return fileList[i].version < fileList[j].version
+	})
+
+	return fileList, nil
+}
+
+// читаем запросы из файла миграции
+func readStatementList(workDir string, path string) ([]string, error) {
+
+	file, err := fileutils.Init(workDir, path)
+	if err != nil {
+		return nil, fmt.Errorf("unable open migration file %s, error: %w", path, err)
+	}
+
+	content, err := file.Read()
+	if err != nil {
+		return nil, fmt.Errorf("unable read migration file %s, error: %w", path, err)
+	}
+
+	return splitStatementList(content), nil
+}
+
+// делим содержимое файла на запросы по ; вне строк и комментариев
+func splitStatementList(content string) []string {
+
+	var statementList []string
+	var current strings.Builder
+	var quote rune
+	isLineComment, isBlockComment := false, false
+
+	runeList := []rune(content)
+	for i := 0; i < len(runeList); i++ {
+
+		char := runeList[i]
+		next := rune(0)
+		if i+1 < len(runeList) {
+			next = runeList[i+1]
+		}
+
+		switch {
+		case isLineComment:
+
+			if char == '\n' {
+				isLineComment = false
+			}
+			continue
+		case isBlockComment:
+
+			if char == '*' && next == '/' {
+
+				isBlockComment = false
+				i++
+			}
+			continue
+		case quote != 0:
+
+			current.WriteRune(char)
+			if char == '\\' && quote != '`' && next != 0 {
+
+				current.WriteRune(next)
+				i++
+			} else if char == quote {
+				quote = 0
+			}
+			continue
+		}
+
+		switch {
+		case char == '#' || (char == '-' && next == '-' && (i+2 >= len(runeList) || runeList[i+2] == ' ' || runeList[i+2] == '\t' || runeList[i+2] == '\n')):
+			isLineComment = true
+		case char == '/' && next == '*' && (i+2 >= len(runeList) || runeList[i+2] != '!'):
+
+			isBlockComment = true
+			i++
+		case char == '\'' || char == '"' || char == '`':
+
+			quote = char
+			current.WriteRune(char)
+		case char == ';':
+
+			statementList = appendStatement(statementList, current.String())
+			current.Reset()
+		default:
+			current.WriteRune(char)
+		}
+	}
+
+	return appendStatement(statementList, current.String())
+}
+
+// добавляем непустой запрос
+func appendStatement(statementList []string, statement string) []string {
+
+	statement = strings.TrimSpace(statement)
+	if statement == "" {
+		return statementList
+	}
+
+	return append(statementList, statement)
+}
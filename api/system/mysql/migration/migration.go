@@ -0,0 +1,383 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/getCompassUtils/go_base_frame/api/system/functions"
+	"github.com/getCompassUtils/go_base_frame/api/system/log"
+	"github.com/getCompassUtils/go_base_frame/api/system/mysql"
+	"github.com/getCompassUtils/go_base_frame/api/system/server"
+)
+
+// -------------------------------------------------------
+// пакет миграций схемы базы данных
+// миграции лежат в директории базы файлами вида 0001_create_user.up.sql и 0001_create_user.down.sql,
+// примененные версии хранятся в таблице базы, одновременно мигрирует только один экземпляр сервиса
+// -------------------------------------------------------
+
+const (
+	defaultTableName   = "schema_migration" // таблица с примененными версиями
+	defaultLockTimeout = 10 * time.Second   // сколько ждем блокировку, пока мигрирует другой экземпляр
+)
+
+// ErrReserveServer миграции на резервном сервере не выполняются
+var ErrReserveServer = errors.New("migrations are not allowed on reserve server")
+
+// ErrLockNotAcquired блокировку держит другой экземпляр
+var ErrLockNotAcquired = errors.New("migration lock is held by another instance")
+
+// ErrDatabaseMismatch пул подключен не к той базе, миграции которой применяем
+var ErrDatabaseMismatch = errors.New("connection database does not match migration database")
+
+// ConfigStruct конфигурация миграций
+type ConfigStruct struct {
+	WorkDir     string        // абсолютный путь рабочей директории
+	Dir         string        // путь к миграциям относительно WorkDir, файлы базы лежат в Dir/Db
+	Db          string        // база данных, миграции которой применяем
+	TableName   string        // таблица с примененными версиями, по умолчанию schema_migration
+	LockTimeout time.Duration // сколько ждем блокировку, по умолчанию 10 секунд, округляется вверх до секунды
+	IsDryRun    bool          // только вернуть и залогировать план, ничего не выполняя
+
+	quotedTableName string // TableName в обратных кавычках
+}
+
+// MigrationStruct миграция из директории
+type MigrationStruct struct {
+	Version       int64    // версия из имени файла
+	Name          string   // имя после версии
+	StatementList []string // запросы, которые выполняются или выполнились бы при dry-run
+}
+
+// StatusStruct состояние миграции
+type StatusStruct struct {
+	Version   int64
+	Name      string
+	IsApplied bool
+	AppliedAt int64 // время применения, 0 – не применена
+}
+
+// -------------------------------------------------------
+// PUBLIC
+// -------------------------------------------------------
+
+// Up применяем все непримененные миграции по возрастанию версии, возвращаем примененные
+func Up(ctx context.Context, connectionItem *mysql.ConnectionPoolItem, config ConfigStruct) ([]MigrationStruct, error) {
+
+	var resultList []MigrationStruct
+	err := runLocked(ctx, connectionItem, config, func(conn *sql.Conn, config ConfigStruct) error {
+
+		fileList, appliedMap, err := getMigrationState(ctx, conn, config)
+		if err != nil {
+			return err
+		}
+
+		for _, file := range fileList {
+
+			if _, isApplied := appliedMap[file.version]; isApplied {
+				continue
+			}
+
+			migration, err := applyMigration(ctx, conn, config, file, file.upPath, true)
+			if err != nil {
+				return err
+			}
+			resultList = append(resultList, migration)
+		}
+
+		return nil
+	})
+
+	return resultList, err
+}
+
+// Down откатываем stepCount последних примененных миграций, возвращаем откаченные
+func Down(ctx context.Context, connectionItem *mysql.ConnectionPoolItem, config ConfigStruct, stepCount int) ([]MigrationStruct, error) {
+
+	var resultList []MigrationStruct
+	err := runLocked(ctx, connectionItem, config, func(conn *sql.Conn, config ConfigStruct) error {
+
+		fileList, appliedMap, err := getMigrationState(ctx, conn, config)
+		if err != nil {
+			return err
+		}
+
+		for i := len(fileList) - 1; i >= 0 && len(resultList) < stepCount; i-- {
+
+			file := fileList[i]
+			if _, isApplied := appliedMap[file.version]; !isApplied {
+				continue
+			}
+
+			if file.downPath == "" {
+				return fmt.Errorf("migration %d_%s has no down file", file.version, file.name)
+			}
+
+			migration, err := applyMigration(ctx, conn, config, file, file.downPath, false)
+			if err != nil {
+				return err
+			}
+			resultList = append(resultList, migration)
+		}
+
+		return nil
+	})
+
+	return resultList, err
+}
+
+// GetStatus получаем состояние всех миграций из директории
+func GetStatus(ctx context.Context, connectionItem *mysql.ConnectionPoolItem, config ConfigStruct) ([]StatusStruct, error) {
+
+	config, err := prepareConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := getConnection(ctx, connectionItem, config.Db)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	fileList, appliedMap, err := getMigrationState(ctx, conn, config)
+	if err != nil {
+		return nil, err
+	}
+
+	statusList := make([]StatusStruct, 0, len(fileList))
+	for _, file := range fileList {
+
+		appliedAt, isApplied := appliedMap[file.version]
+		statusList = append(statusList, StatusStruct{
+			Version:   file.version,
+			Name:      file.name,
+			IsApplied: isApplied,
+			AppliedAt: appliedAt,
+		})
+	}
+
+	return statusList, nil
+}
+
+// -------------------------------------------------------
+// PROTECTED
+// -------------------------------------------------------
+
+// заполняем значения по умолчанию и проверяем имя таблицы версий
+func prepareConfig(config ConfigStruct) (ConfigStruct, error) {
+
+	if config.TableName == "" {
+		config.TableName = defaultTableName
+	}
+	if config.LockTimeout <= 0 {
+		config.LockTimeout = defaultLockTimeout
+	}
+
+	// таблица версий лежит в базе миграций, имя с базой не нашлось бы в information_schema текущей базы
+	quotedTableName, err := mysql.QuoteIdentifier(config.TableName)
+	if err != nil || strings.ContainsAny(config.TableName, ".*") {
+		return ConfigStruct{}, fmt.Errorf("incorrect migration table name '%s'", config.TableName)
+	}
+	config.quotedTableName = quotedTableName
+
+	return config, nil
+}
+
+// получаем выделенное соединение и проверяем, что оно подключено к базе миграций
+// иначе миграции и таблица версий одной базы попали бы в другую
+func getConnection(ctx context.Context, connectionItem *mysql.ConnectionPoolItem, db string) (*sql.Conn, error) {
+
+	conn, err := connectionItem.GetConnectionPool().Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable get connection, error: %w", err)
+	}
+
+	var currentDb sql.NullString
+	err = conn.QueryRowContext(ctx, "SELECT DATABASE()").Scan(&currentDb)
+	if err != nil {
+
+		_ = conn.Close()
+		return nil, fmt.Errorf("unable get connection database, error: %w", err)
+	}
+	if currentDb.String != db {
+
+		_ = conn.Close()
+		return nil, fmt.Errorf("%w: connection uses '%s', migrations are for '%s'", ErrDatabaseMismatch, currentDb.String, db)
+	}
+
+	return conn, nil
+}
+
+// выполняем функцию под блокировкой на выделенном соединении
+// блокировка GET_LOCK живет, пока живет соединение, поэтому все запросы идут через него
+func runLocked(ctx context.Context, connectionItem *mysql.ConnectionPoolItem, config ConfigStruct, callback func(conn *sql.Conn, config ConfigStruct) error) error {
+
+	if server.IsReserveServer() {
+		return ErrReserveServer
+	}
+
+	config, err := prepareConfig(config)
+	if err != nil {
+		return err
+	}
+
+	conn, err := getConnection(ctx, connectionItem, config.Db)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	// GET_LOCK принимает таймаут в секундах, доли секунды округляем вверх, чтобы не получить нулевое ожидание
+	lockName := "migration_" + config.Db
+	lockTimeout := int((config.LockTimeout + time.Second - 1) / time.Second)
+	var isLocked sql.NullInt64
+	err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", lockName, lockTimeout).Scan(&isLocked)
+	if err != nil {
+		return fmt.Errorf("unable get migration lock, error: %w", err)
+	}
+	if isLocked.Int64 != 1 {
+		return ErrLockNotAcquired
+	}
+
+	defer func() {
+
+		// контекст мог уже закончиться, а блокировку нужно отпустить
+		_, err := conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", lockName)
+		if err != nil {
+			log.Errorf("unable release migration lock %s, error: %v", lockName, err)
+		}
+	}()
+
+	if !config.IsDryRun {
+
+		err = createVersionTable(ctx, conn, config)
+		if err != nil {
+			return err
+		}
+	}
+
+	return callback(conn, config)
+}
+
+// получаем миграции из директории и примененные версии
+func getMigrationState(ctx context.Context, conn *sql.Conn, config ConfigStruct) ([]migrationFileStruct, map[int64]int64, error) {
+
+	fileList, err := readMigrationFileList(config.WorkDir, config.Dir, config.Db)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	appliedMap, err := getAppliedVersionMap(ctx, conn, config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return fileList, appliedMap, nil
+}
+
+// создаем таблицу версий, если ее нет
+func createVersionTable(ctx context.Context, conn *sql.Conn, config ConfigStruct) error {
+
+	query := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s ("+
+		"`version` BIGINT UNSIGNED NOT NULL, "+
+		"`name` VARCHAR(255) NOT NULL, "+
+		"`applied_at` INT UNSIGNED NOT NULL, "+
+		"PRIMARY KEY (`version`))", config.quotedTableName)
+
+	_, err := conn.ExecContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("unable create migration table %s, error: %w", config.TableName, err)
+	}
+
+	return nil
+}
+
+// получаем примененные версии и время их применения, нет таблицы – нет примененных версий
+func getAppliedVersionMap(ctx context.Context, conn *sql.Conn, config ConfigStruct) (map[int64]int64, error) {
+
+	appliedMap := make(map[int64]int64)
+
+	var count int
+	err := conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?", config.TableName).Scan(&count)
+	if err != nil {
+		return nil, fmt.Errorf("unable check migration table %s, error: %w", config.TableName, err)
+	}
+	if count == 0 {
+		return appliedMap, nil
+	}
+
+	rows, err := conn.QueryContext(ctx, fmt.Sprintf("SELECT `version`, `applied_at` FROM %s", config.quotedTableName))
+	if err != nil {
+		return nil, fmt.Errorf("unable get applied migrations, error: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+
+		var version, appliedAt int64
+		err = rows.Scan(&version, &appliedAt)
+		if err != nil {
+			return nil, fmt.Errorf("unable read applied migration, error: %w", err)
+		}
+		appliedMap[version] = appliedAt
+	}
+
+	return appliedMap, rows.Err()
+}
+
+// применяем или откатываем миграцию, при dry-run только логируем запросы
+func applyMigration(ctx context.Context, conn *sql.Conn, config ConfigStruct, file migrationFileStruct, path string, isUp bool) (MigrationStruct, error) {
+
+	statementList, err := readStatementList(config.WorkDir, path)
+	if err != nil {
+		return MigrationStruct{}, err
+	}
+
+	migration := MigrationStruct{Version: file.version, Name: file.name, StatementList: statementList}
+	direction := "down"
+	if isUp {
+		direction = "up"
+	}
+
+	if config.IsDryRun {
+
+		log.Infof("dry-run migration %d_%s %s on %s: %d statements", file.version, file.name, direction, config.Db, len(statementList))
+		for _, statement := range statementList {
+			log.Infof("  %s", statement)
+		}
+		return migration, nil
+	}
+
+	// DDL в mysql фиксируется сразу, поэтому транзакция здесь не поможет – выполняем по очереди
+	for i, statement := range statementList {
+
+		_, err = conn.ExecContext(ctx, statement)
+		if err != nil {
+			return MigrationStruct{}, fmt.Errorf("migration %d_%s %s failed on statement %d, error: %w", file.version, file.name, direction, i+1, err)
+		}
+	}
+
+	if isUp {
+		_, err = conn.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (`version`, `name`, `applied_at`) VALUES (?, ?, ?)", config.quotedTableName),
+			file.version, file.name, functions.GetCurrentTimeStamp())
+	} else {
+		_, err = conn.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE `version` = ?", config.quotedTableName), file.version)
+	}
+	if err != nil {
+		return MigrationStruct{}, fmt.Errorf("unable save migration %d_%s version, error: %w", file.version, file.name, err)
+	}
+
+	log.Infof("migration %d_%s %s applied on %s", file.version, file.name, direction, config.Db)
+	return migration, nil
+}
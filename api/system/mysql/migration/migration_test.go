@@ -0,0 +1,51 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	sqlmock "github.com/getCompassUtils/go_base_frame/api/_modules/go-sqlmock"
+	"github.com/getCompassUtils/go_base_frame/api/system/mysql"
+)
+
+// проверяем имя таблицы версий
+func TestPrepareConfigTableName(t *testing.T) {
+
+	config, err := prepareConfig(ConfigStruct{Db: "company"})
+	if err != nil || config.quotedTableName != "`schema_migration`" {
+		t.Fatalf("quotedTableName = %q, err = %v", config.quotedTableName, err)
+	}
+
+	for _, tableName := range []string{"migration`; DROP TABLE user; --", "other_db.schema_migration", "*"} {
+
+		if _, err = prepareConfig(ConfigStruct{Db: "company", TableName: tableName}); err == nil {
+			t.Fatalf("expected error for table name %q", tableName)
+		}
+	}
+}
+
+// проверяем, что миграции не запускаются на пуле другой базы
+func TestGetConnectionDatabaseMismatch(t *testing.T) {
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("unable create sqlmock: %v", err)
+	}
+	connectionItem := mysql.ReplaceHostConnection("company_1", "migration_test", db)
+	defer func() {
+		_ = mysql.RemoveMysqlConnectionPool("company_1", "migration_test")
+	}()
+
+	mock.ExpectQuery("SELECT DATABASE()").WillReturnRows(sqlmock.NewRows([]string{"DATABASE()"}).AddRow("company_1"))
+	if _, err = getConnection(context.Background(), connectionItem, "company_2"); !errors.Is(err, ErrDatabaseMismatch) {
+		t.Fatalf("err = %v, want ErrDatabaseMismatch", err)
+	}
+
+	mock.ExpectQuery("SELECT DATABASE()").WillReturnRows(sqlmock.NewRows([]string{"DATABASE()"}).AddRow("company_1"))
+	conn, err := getConnection(context.Background(), connectionItem, "company_1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = conn.Close()
+}
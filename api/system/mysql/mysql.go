@@ -5,14 +5,13 @@ import (
 	"database/sql"
 	"fmt"
 	"reflect"
-	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/getCompassUtils/go_base_frame/api/system/functions"
 	"github.com/getCompassUtils/go_base_frame/api/system/log"
-	"github.com/getCompassUtils/go_base_frame/api/system/server"
 	_ "github.com/go-sql-driver/mysql"
 )
 
@@ -24,13 +23,26 @@ import (
 // таймауты нужны, чтобы зависший запрос не занял надолго подключение к базе.
 // подключений ограниченное количество, а значит есть риск создать очередь запросов из-за зависших подключений
 const pingTimeout = 200 * time.Millisecond // таймаут для пинга
-const QueryTimeout = 5 * time.Second       // таймаут для запросов
+const QueryTimeout = 5 * time.Second       // таймаут для запросов по умолчанию, пул может задать свой
 
 // ConnectionPoolItem структура объекта подключения к базе данных
 type ConnectionPoolItem struct {
-	ConnectionPool *sql.DB
+	ConnectionPool *sql.DB                // пул на момент создания, закрывается при пересоздании, текущий возвращает GetConnectionPool
+	pool           atomic.Pointer[sql.DB] // пул после пересоздания, nil – ConnectionPool
+	reopenMu       sync.Mutex             // защищает config при пересоздании
 	createdAt      int64
 	dbKey          string
+	host           string
+	config         ConnectionConfigStruct // конфигурация, по которой пул пересоздается
+	location       *time.Location         // часовой пояс из конфигурации, в нем разбираются даты в FetchOne/FetchAll
+	health         poolHealthStruct
+	retryPolicy    atomic.Pointer[RetryPolicyStruct]
+	hookList       hookListStruct
+	slowQueryHook  atomic.Pointer[slowQueryHookStruct]
+	statementCache atomic.Pointer[statementCacheStruct]
+	queryTimeout   atomic.Int64 // таймаут запросов в наносекундах, 0 – QueryTimeout
+	queryCache     atomic.Pointer[queryCacheStruct]
+	outbox         atomic.Pointer[outboxStruct]
 }
 
 // объявляем хранилище
@@ -38,17 +50,29 @@ var mysqlConnectionPoolList = sync.Map{}
 
 // TransactionStruct структура транзакции
 type TransactionStruct struct {
-	transaction *sql.Tx
-	dbKey       string
+	transaction    *sql.Tx
+	dbKey          string
+	savepointCount int                 // сколько точек сохранения создано во вложенных RunInTransaction
+	connectionItem *ConnectionPoolItem // пул, в котором начата транзакция
+	writeQueryList []string            // запросы на запись, по которым после подтверждения сбрасывается кэш пула
 }
 
 // структура для форматирования ответа
 type queryStruct struct {
-	rows       *sql.Rows
-	columnList []string
-	valueList  []sql.RawBytes
-	scanList   []interface{}
-	err        error
+	rows           *sql.Rows
+	columnList     []string
+	columnTypeList []*sql.ColumnType
+	valueList      []sql.RawBytes
+	scanList       []interface{}
+	location       *time.Location // часовой пояс, в котором разбираются даты
+	err            error
+}
+
+// ValueStruct значение колонки, сохраняющее NULL и тип колонки в базе
+type ValueStruct struct {
+	Value        string // значение колонки, для NULL – пустая строка
+	IsNull       bool   // пришел ли NULL
+	DatabaseType string // тип колонки в базе, например VARCHAR, BIGINT, JSON
 }
 
 // -------------------------------------------------------
@@ -58,50 +82,60 @@ type queryStruct struct {
 // ReplaceConnection обновить объект пула подключений
 func ReplaceConnection(db string, conn *sql.DB) {
 
-	// заносим подключение в кэш
-	connectionPoolItem := ConnectionPoolItem{
-		ConnectionPool: conn,
-		createdAt:      functions.GetCurrentTimeStamp(),
-		dbKey:          db,
-	}
+	replaceConnectionPool(db, db, "", conn)
+}
 
-	// перезаписываем объект подключения
-	connectionPoolItem.ConnectionPool = conn
-	mysqlConnectionPoolList.Store(db, &connectionPoolItem)
+// ReplaceHostConnection подменяем пул базы на хосте, его вернет GetMysqlConnection с теми же db и host
+// например пул на sqlmock в тестах сервиса
+func ReplaceHostConnection(db string, host string, conn *sql.DB) *ConnectionPoolItem {
+
+	return replaceConnectionPool(host+"-"+db, db, host, conn)
 }
 
 // CreateMysqlConnection создаем mysql подключение без сохранения в мапу
 func CreateMysqlConnection(ctx context.Context, db string, host string, user string, pass string, maxConnections int, isSsl bool) (*ConnectionPoolItem, error) {
 
+	return CreateMysqlConnectionWithConfig(ctx, NewConnectionConfig(db, host, user, pass, maxConnections, isSsl))
+}
+
+// CreateMysqlConnectionWithConfig создаем mysql подключение по конфигурации без сохранения в мапу
+func CreateMysqlConnectionWithConfig(ctx context.Context, config ConnectionConfigStruct) (*ConnectionPoolItem, error) {
+
 	// cоздаем пул соединений с mysql
-	mysqlConnectionPool, err := openMysqlConnectionPool(db, host, user, pass, maxConnections, isSsl)
+	mysqlConnectionPool, err := openMysqlConnectionPool(config)
 
 	// !!! СОЗДАНИЕ ПУЛА НЕ ПРОВЕРЯЕТ НАЛИЧИЕ СОЕДИНЕНИЯ
 	if err != nil {
 
-		log.Errorf("error when creating db connection pool `%s`, err: %s", db, err.Error())
+		log.Errorf("error when creating db connection pool `%s`, err: %s", config.Db, err.Error())
 		return nil, err
 	}
 
 	// устанавливаем первое соединение, сразу проверяя, что база доступна
 	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
 	defer cancel()
-	err = mysqlConnectionPool.ConnectionPool.PingContext(ctx)
+	err = mysqlConnectionPool.GetConnectionPool().PingContext(ctx)
 
 	if err != nil {
 
-		log.Errorf("error when connect to database `%s`, err: %s", db, err.Error())
+		log.Errorf("error when connect to database `%s`, err: %s", config.Db, err.Error())
 		return nil, err
 	}
 
-	log.Infof("Открыл соединение к базе %s", db)
+	log.Infof("Открыл соединение к базе %s", config.Db)
 	return mysqlConnectionPool, nil
 }
 
 // GetMysqlConnection получаем хранимое mysql подключение
 func GetMysqlConnection(ctx context.Context, db string, host string, user string, pass string, maxConnections int, isSsl bool) (*ConnectionPoolItem, error) {
 
-	uniqueKey := host + "-" + db
+	return GetMysqlConnectionWithConfig(ctx, NewConnectionConfig(db, host, user, pass, maxConnections, isSsl))
+}
+
+// GetMysqlConnectionWithConfig получаем хранимое mysql подключение, создавая его по конфигурации
+func GetMysqlConnectionWithConfig(ctx context.Context, config ConnectionConfigStruct) (*ConnectionPoolItem, error) {
+
+	uniqueKey := config.Host + "-" + config.Db
 	mysqlConnectionPool, exist := mysqlConnectionPoolList.Load(uniqueKey)
 
 	// если не было пула соединений - создаем
@@ -109,69 +143,91 @@ func GetMysqlConnection(ctx context.Context, db string, host string, user string
 		return mysqlConnectionPool.(*ConnectionPoolItem), nil
 	}
 
-	mysqlConnectionPool, err := openMysqlConnectionPool(db, host, user, pass, maxConnections, isSsl)
+	mysqlConnectionPool, err := openMysqlConnectionPool(config)
 
 	// !!! СОЗДАНИЕ ПУЛА НЕ ПРОВЕРЯЕТ НАЛИЧИЕ СОЕДИНЕНИЯ
 	if err != nil {
 
-		log.Errorf("error when creating db connection pool `%s`, err: %s", db, err.Error())
+		log.Errorf("error when creating db connection pool `%s`, err: %s", config.Db, err.Error())
 		return nil, err
 	}
 
 	// устанавливаем первое соединение, сразу проверяя, что база доступна
 	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
 	defer cancel()
-	err = mysqlConnectionPool.(*ConnectionPoolItem).ConnectionPool.PingContext(ctx)
+	err = mysqlConnectionPool.(*ConnectionPoolItem).GetConnectionPool().PingContext(ctx)
 
 	if err != nil {
 
-		log.Errorf("error when connect to database `%s`, err: %s", db, err.Error())
+		log.Errorf("error when connect to database `%s`, err: %s", config.Db, err.Error())
 		return nil, err
 	}
 
-	log.Infof("Открыл соединение к базе %s", db)
+	log.Infof("Открыл соединение к базе %s", config.Db)
 	mysqlConnectionPoolList.Store(uniqueKey, mysqlConnectionPool)
 
 	return mysqlConnectionPool.(*ConnectionPoolItem), nil
 }
 
+// сохраняем пул под ключом, подготовленные запросы старого пула к новому не относятся – сбрасываем их, сохраняя размер кэша
+func replaceConnectionPool(key string, db string, host string, conn *sql.DB) *ConnectionPoolItem {
+
+	connectionPoolItem := &ConnectionPoolItem{
+		ConnectionPool: conn,
+		createdAt:      functions.GetCurrentTimeStamp(),
+		dbKey:          db,
+		host:           host,
+	}
+
+	oldItem, isLoaded := mysqlConnectionPoolList.Swap(key, connectionPoolItem)
+	if isLoaded {
+		connectionPoolItem.inheritStatementCache(oldItem.(*ConnectionPoolItem))
+	}
+
+	return connectionPoolItem
+}
+
 // открываем соединение
-func openMysqlConnectionPool(db string, host string, user string, pass string, maxConnections int, isSsl bool) (*ConnectionPoolItem, error) {
+func openMysqlConnectionPool(config ConnectionConfigStruct) (*ConnectionPoolItem, error) {
 
-	connectionPool, err := connectToDb(db, host, user, pass, maxConnections, isSsl)
+	connectionPool, err := connectToDb(config)
 
 	// заносим подключение в кэш
 	connectionPoolItem := ConnectionPoolItem{
 		ConnectionPool: connectionPool,
 		createdAt:      functions.GetCurrentTimeStamp(),
-		dbKey:          db,
+		dbKey:          config.Db,
+		host:           config.Host,
+		config:         config,
+		location:       config.Loc,
 	}
 
 	return &connectionPoolItem, err
 }
 
 // подключаемся в базе
-func connectToDb(db string, host string, user string, pass string, maxConnections int, isSsl bool) (*sql.DB, error) {
+func connectToDb(config ConnectionConfigStruct) (*sql.DB, error) {
 
 	// получаем параметры подключения к базе данных
-	connectionString := fmt.Sprintf("%s:%s@tcp(%s)/%s", user, pass, host, db)
+	connectionString, err := config.formatDsn()
+	if err != nil {
 
-	// добавляем ssl, если нужно
-	if isSsl {
-		connectionString = fmt.Sprintf("%s%s", connectionString, "?tls=skip-verify")
+		log.Errorf("unable format mysql connection string, database: '%s', error: %v", config.Db, err)
+		return nil, err
 	}
 
 	connection, err := sql.Open("mysql", connectionString)
 	if err != nil {
 
-		log.Errorf("unable open mysql connection, database: '%s', error: %v", db, err)
+		log.Errorf("unable open mysql connection, database: '%s', error: %v", config.Db, err)
 		return connection, err
 	}
 
 	// ограничиваем кол-во одновременно открытых соединений с базой данных
-	connection.SetMaxOpenConns(maxConnections)
-	connection.SetMaxIdleConns(maxConnections)
-	connection.SetConnMaxLifetime(time.Minute * 1)
+	connection.SetMaxOpenConns(config.MaxConnections)
+	connection.SetMaxIdleConns(config.getMaxIdleConnections())
+	connection.SetConnMaxLifetime(config.getConnMaxLifetime())
+	connection.SetConnMaxIdleTime(config.ConnMaxIdleTime)
 	return connection, nil
 }
 
@@ -180,7 +236,8 @@ func RemoveMysqlConnectionPool(db string, host string) error {
 
 	uniqueKey := host + "-" + db
 
-	item, exist := mysqlConnectionPoolList.Load(uniqueKey)
+	// убираем пул из хранилища до закрытия, чтобы ошибка закрытия не оставила в нем закрытый пул
+	item, exist := mysqlConnectionPoolList.LoadAndDelete(uniqueKey)
 
 	// если не было пула соединений - то и закрывать нечего
 	if !exist {
@@ -192,17 +249,16 @@ func RemoveMysqlConnectionPool(db string, host string) error {
 	err := mysqlConnectionPool.Close()
 
 	if err != nil {
-		return fmt.Errorf("cant close db on host %s for db %s", host, db)
+		return fmt.Errorf("cant close db on host %s for db %s, error: %w", host, db, err)
 	}
 
-	mysqlConnectionPoolList.Delete(uniqueKey)
 	return nil
 }
 
 // Ping функция для пинга соединения
 func (connectionItem *ConnectionPoolItem) Ping() error {
 
-	return connectionItem.ConnectionPool.Ping()
+	return connectionItem.GetConnectionPool().Ping()
 }
 
 // -------------------------------------------------------
@@ -212,61 +268,42 @@ func (connectionItem *ConnectionPoolItem) Ping() error {
 // GetAll получаем массив из запроса
 func (connectionItem *ConnectionPoolItem) GetAll(ctx context.Context, query string, args ...interface{}) (map[int]map[string]string, error) {
 
-	queryContext, cancel := context.WithTimeout(ctx, QueryTimeout)
-	defer cancel()
-
-	// осуществляем запрос
-	queryItem, err := connectionItem.sendQueryForFormat(queryContext, query, args...)
-	if err != nil {
-
-		log.Errorf("unable send query, error: %v", err)
-		return map[int]map[string]string{}, err
-	}
-
-	response := queryItem.formatFetchArrayQuery()
-	return response, queryItem.err
+	// временные ошибки повторяем по политике пула
+	return fetchWithRetry(ctx, connectionItem, (*queryStruct).formatFetchArrayQuery, map[int]map[string]string{}, query, args...)
 }
 
 // FetchQuery получаем ответ после запроса
 func (connectionItem *ConnectionPoolItem) FetchQuery(ctx context.Context, query string, args ...interface{}) (map[string]string, error) {
 
-	queryContext, cancel := context.WithTimeout(ctx, QueryTimeout)
-	defer cancel()
-
-	// осуществляем запрос
-	queryItem, err := connectionItem.sendQueryForFormat(queryContext, query, args...)
-	if err != nil {
-
-		log.Errorf("unable send query, error: %v", err)
-		return map[string]string{}, err
-	}
-
-	response := queryItem.formatFetchQuery()
-	return response, queryItem.err
+	// временные ошибки повторяем по политике пула
+	return fetchWithRetry(ctx, connectionItem, (*queryStruct).formatFetchQuery, map[string]string{}, query, args...)
 }
 
 // FetchList получаем одномерный массив из запроса
 func (connectionItem *ConnectionPoolItem) FetchList(ctx context.Context, query string, args ...interface{}) ([]string, error) {
 
-	queryContext, cancel := context.WithTimeout(ctx, QueryTimeout)
-	defer cancel()
+	// временные ошибки повторяем по политике пула
+	return fetchWithRetry(ctx, connectionItem, (*queryStruct).formatFetchList, []string{}, query, args...)
+}
 
-	// осуществляем запрос
-	queryItem, err := connectionItem.sendQueryForFormat(queryContext, query, args...)
-	if err != nil {
+// GetAllTyped получаем массив из запроса, сохраняя NULL и тип колонок
+func (connectionItem *ConnectionPoolItem) GetAllTyped(ctx context.Context, query string, args ...interface{}) (map[int]map[string]ValueStruct, error) {
 
-		log.Errorf("unable send query, error: %v", err)
-		return []string{}, err
-	}
+	// временные ошибки повторяем по политике пула
+	return fetchWithRetry(ctx, connectionItem, (*queryStruct).formatFetchArrayTypedQuery, map[int]map[string]ValueStruct{}, query, args...)
+}
 
-	response := queryItem.formatFetchList()
-	return response, queryItem.err
+// FetchQueryTyped получаем ответ после запроса, сохраняя NULL и тип колонок
+func (connectionItem *ConnectionPoolItem) FetchQueryTyped(ctx context.Context, query string, args ...interface{}) (map[string]ValueStruct, error) {
+
+	// временные ошибки повторяем по политике пула
+	return fetchWithRetry(ctx, connectionItem, (*queryStruct).formatFetchTypedQuery, map[string]ValueStruct{}, query, args...)
 }
 
 // Close закрываем соединение
 func (connectionItem *ConnectionPoolItem) Close() error {
 
-	return connectionItem.ConnectionPool.Close()
+	return connectionItem.GetConnectionPool().Close()
 }
 
 // Insert осуществляем запрос вставки
@@ -274,8 +311,9 @@ func (connectionItem *ConnectionPoolItem) Insert(ctx context.Context, tableName
 
 	var keys, valueKeys string
 	var values []interface{}
-	for k, v := range insert {
+	for _, k := range getSortedKeyList(insert) {
 
+		v := insert[k]
 		keys += fmt.Sprintf("`%s` , ", k)
 		valueKeys += "? , "
 		values = append(values, v)
@@ -291,16 +329,17 @@ func (connectionItem *ConnectionPoolItem) Insert(ctx context.Context, tableName
 	query := fmt.Sprintf("INSERT %sINTO %s (%s) VALUES (%s)", ignore, tableName, keys, valueKeys)
 
 	// если резервный и запрос меняет бд
-	if server.IsReserveServer() && !isAllowWriteTable(connectionItem.dbKey, query) {
-		return 0, nil
+	if isBlocked, err := checkWriteOnReserve(connectionItem.dbKey, query); isBlocked {
+		return 0, err
 	}
 
-	queryCtx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	queryCtx, cancel := connectionItem.withQueryTimeout(ctx)
 	defer cancel()
 
-	res, err := connectionItem.ConnectionPool.ExecContext(queryCtx, query, values...)
+	change := outboxChangeStruct{tableName: tableName, operation: OutboxOperationInsert, data: insert}
+	res, err := connectionItem.execWithOutbox(queryCtx, change, query, values...)
 	if err != nil {
-		return 0, fmt.Errorf("query: %s, error: %v", query, err)
+		return 0, fmt.Errorf("query: %s, error: %w", query, err)
 	}
 	rows, _ := res.RowsAffected()
 	return rows, nil
@@ -311,8 +350,9 @@ func (connectionItem *ConnectionPoolItem) InsertOrUpdate(ctx context.Context, ta
 
 	var keys, valueKeys, updateKeys string
 	var values []interface{}
-	for k, v := range insert {
+	for _, k := range getSortedKeyList(insert) {
 
+		v := insert[k]
 		keys += fmt.Sprintf("`%s` , ", k)
 		valueKeys += "? , "
 		updateKeys += fmt.Sprintf("`%s` = ? , ", k)
@@ -328,16 +368,17 @@ func (connectionItem *ConnectionPoolItem) InsertOrUpdate(ctx context.Context, ta
 		tableName, keys, valueKeys, updateKeys)
 
 	// если резервный и запрос меняет бд
-	if server.IsReserveServer() && !isAllowWriteTable(connectionItem.dbKey, query) {
-		return nil
+	if isBlocked, err := checkWriteOnReserve(connectionItem.dbKey, query); isBlocked {
+		return err
 	}
 
-	queryCtx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	queryCtx, cancel := connectionItem.withQueryTimeout(ctx)
 	defer cancel()
 
-	_, err := connectionItem.ConnectionPool.ExecContext(queryCtx, query, values...)
+	change := outboxChangeStruct{tableName: tableName, operation: OutboxOperationUpsert, data: insert}
+	_, err := connectionItem.execWithOutbox(queryCtx, change, query, values...)
 	if err != nil {
-		return fmt.Errorf("query: %s, error: %v", query, err)
+		return fmt.Errorf("query: %s, error: %w", query, err)
 	}
 
 	return nil
@@ -346,36 +387,50 @@ func (connectionItem *ConnectionPoolItem) InsertOrUpdate(ctx context.Context, ta
 // Update осуществляем запрос update
 func (connectionItem *ConnectionPoolItem) Update(ctx context.Context, query string, args ...interface{}) (int64, error) {
 
+	res, err := connectionItem.execUpdate(ctx, query, args...)
+	if err != nil || res == nil {
+		return 0, err
+	}
+
+	rows, _ := res.RowsAffected()
+	return rows, nil
+}
+
+// выполняем запрос на обновление, на резервном сервере результат пустой
+func (connectionItem *ConnectionPoolItem) execUpdate(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+
 	// если резервный и запрос меняет бд
-	if server.IsReserveServer() && !isAllowWriteTable(connectionItem.dbKey, query) {
-		return 0, nil
+	if isBlocked, err := checkWriteOnReserve(connectionItem.dbKey, query); isBlocked {
+		return nil, err
 	}
 
-	queryCtx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	queryCtx, cancel := connectionItem.withQueryTimeout(ctx)
 	defer cancel()
 
 	// проверяем соединение и осуществляем запрос
-	res, err := connectionItem.ConnectionPool.ExecContext(queryCtx, query, args...)
+	res, err := connectionItem.execWithOutbox(queryCtx, outboxChangeStruct{operation: OutboxOperationUpdate}, query, args...)
 	if err != nil {
-		return 0, fmt.Errorf("query: %s, error: %v", query, err)
+		return nil, fmt.Errorf("query: %s, error: %w", query, err)
 	}
 
-	rows, _ := res.RowsAffected()
-	return rows, nil
+	return res, nil
 }
 
 // Query осуществляем запрос
 func (connectionItem *ConnectionPoolItem) Query(ctx context.Context, query string, args ...interface{}) error {
 
 	// если резервный и запрос меняет бд
-	if server.IsReserveServer() && isWriteRows(query) && !isAllowWriteTable(connectionItem.dbKey, query) {
-		return nil
+	if isBlocked, err := checkQueryOnReserve(connectionItem.dbKey, query); isBlocked {
+		return err
 	}
 
+	queryCtx, cancel := connectionItem.withQueryTimeout(ctx)
+	defer cancel()
+
 	// проверяем соединение и осуществляем запрос
-	_, err := connectionItem.ConnectionPool.ExecContext(ctx, query, args...)
+	_, err := connectionItem.execContext(queryCtx, query, args...)
 	if err != nil {
-		return fmt.Errorf("query: %s, error: %v", query, err)
+		return fmt.Errorf("query: %s, error: %w", query, err)
 	}
 
 	return nil
@@ -384,54 +439,31 @@ func (connectionItem *ConnectionPoolItem) Query(ctx context.Context, query strin
 // InsertArray функция для вставки массива записей в базу
 func (connectionItem *ConnectionPoolItem) InsertArray(ctx context.Context, tableName string, columnList []string, insertDataList [][]interface{}) error {
 
-	var columnString, valueString string
-	for _, column := range columnList {
-		columnString += column + ", "
-	}
-
-	columnString = columnString[:len(columnString)-2]
-
-	var valueList []interface{}
-	for _, insertData := range insertDataList {
-
-		valueString += "("
-		for _, v := range insertData {
-
-			valueString += "?, "
-			valueList = append(valueList, v)
-		}
-		valueString = valueString[:len(valueString)-2] + "), "
-	}
-	valueString = valueString[:len(valueString)-2]
-
-	query := fmt.Sprintf("INSERT IGNORE INTO `%s` (%s) VALUES %s", tableName, columnString, valueString)
-
-	// если резервный и запрос меняет бд
-	if server.IsReserveServer() && !isAllowWriteTable(connectionItem.dbKey, query) {
-		return nil
+	// большой массив вставляем пачками, чтобы не упереться в лимиты сервера
+	queryList, err := InsertArray(tableName, columnList, insertDataList)
+	if err != nil {
+		return err
 	}
 
-	queryCtx, cancel := context.WithTimeout(ctx, QueryTimeout)
-	defer cancel()
-
-	return connectionItem.Query(queryCtx, query, valueList...)
+	_, err = connectionItem.execBulkQueryList(ctx, queryList)
+	return err
 }
 
 // осуществляем запрос, возвращаем объект для форматирования ответа
 func (connectionItem *ConnectionPoolItem) sendQueryForFormat(ctx context.Context, query string, args ...interface{}) (*queryStruct, error) {
 
 	// инициализируем объект для обработки ответа
-	queryItem := &queryStruct{}
+	queryItem := &queryStruct{location: connectionItem.getLocation()}
 
 	// если резервный и запрос меняет бд
-	if server.IsReserveServer() && isWriteRows(query) && !isAllowWriteTable(connectionItem.dbKey, query) {
-		return queryItem, nil
+	if isBlocked, err := checkQueryOnReserve(connectionItem.dbKey, query); isBlocked {
+		return queryItem, err
 	}
 
 	// осуществляем запрос
-	queryItem.rows, queryItem.err = connectionItem.ConnectionPool.QueryContext(ctx, query, args...)
+	queryItem.rows, queryItem.err = connectionItem.queryContext(ctx, query, args...)
 	if queryItem.err != nil {
-		return &queryStruct{}, fmt.Errorf("unable send query: '%s', error: %v", query, queryItem.err)
+		return &queryStruct{}, fmt.Errorf("unable send query: '%s', error: %w", query, queryItem.err)
 	}
 
 	// получаем поля таблицы
@@ -439,7 +471,15 @@ func (connectionItem *ConnectionPoolItem) sendQueryForFormat(ctx context.Context
 	if queryItem.err != nil {
 
 		_ = queryItem.rows.Close()
-		return &queryStruct{}, fmt.Errorf("no table field in response, query: '%s', error: %v", query, queryItem.err)
+		return &queryStruct{}, fmt.Errorf("no table field in response, query: '%s', error: %w", query, queryItem.err)
+	}
+
+	// получаем типы полей таблицы
+	queryItem.columnTypeList, queryItem.err = queryItem.rows.ColumnTypes()
+	if queryItem.err != nil {
+
+		_ = queryItem.rows.Close()
+		return &queryStruct{}, fmt.Errorf("no column types in response, query: '%s', error: %w", query, queryItem.err)
 	}
 
 	// создаем массив значений и массив для rows.Scan
@@ -460,15 +500,11 @@ func (connectionItem *ConnectionPoolItem) sendQueryForFormat(ctx context.Context
 func (connectionItem *ConnectionPoolItem) BeginTransaction() (TransactionStruct, error) {
 
 	// начинаем транзакцию
-	transactionItem, err := connectionItem.ConnectionPool.Begin()
-	if err != nil {
-		return TransactionStruct{nil, connectionItem.dbKey}, err
-	}
-	return TransactionStruct{transactionItem, connectionItem.dbKey}, nil
+	return connectionItem.BeginTransactionContext(context.Background(), nil)
 }
 
 // InsertArray функция для вставки массива записей в базу
-func (transactionItem *TransactionStruct) InsertArray(ctx context.Context, tableName string, columnList []string, insertDataList [][]interface{}, isIgnore bool) {
+func (transactionItem *TransactionStruct) InsertArray(ctx context.Context, tableName string, columnList []string, insertDataList [][]interface{}, isIgnore bool) error {
 
 	var columnString = ""
 	var valuesString = ""
@@ -477,7 +513,7 @@ func (transactionItem *TransactionStruct) InsertArray(ctx context.Context, table
 		valuesString += "?, "
 	}
 	if len(columnString) < 1 {
-		return
+		return nil
 	}
 
 	columnString = columnString[:len(columnString)-2]
@@ -488,30 +524,44 @@ func (transactionItem *TransactionStruct) InsertArray(ctx context.Context, table
 		ignore = "IGNORE "
 	}
 
+	query := fmt.Sprintf("INSERT %sINTO %s (%s) VALUES (%s)", ignore, tableName, columnString, valuesString)
+
 	// если резервный и запрос меняет бд
-	if server.IsReserveServer() && !isAllowWriteTable(transactionItem.dbKey, tableName) {
-		return
+	if isBlocked, err := checkWriteOnReserve(transactionItem.dbKey, query); isBlocked {
+		return err
 	}
 
-	queryContext, cancel := context.WithTimeout(ctx, QueryTimeout)
+	queryContext, cancel := transactionItem.withQueryTimeout(ctx)
 	defer cancel()
 
-	query := fmt.Sprintf("INSERT %sINTO %s (%s) VALUES (%s)", ignore, tableName, columnString, valuesString)
-	stmt, _ := transactionItem.transaction.Prepare(query)
+	stmt, err := transactionItem.transaction.PrepareContext(queryContext, query)
+	if err != nil {
+		return fmt.Errorf("unable prepare query: %s, error: %w", query, err)
+	}
+	defer func() {
+		_ = stmt.Close()
+	}()
+
 	for _, v := range insertDataList {
-		_, _ = stmt.ExecContext(queryContext, v...)
+
+		_, err = transactionItem.execStatementContext(queryContext, stmt, query, v...)
+		if err != nil {
+			return fmt.Errorf("query: %s, error: %w", query, err)
+		}
 	}
+
+	return nil
 }
 
 // FetchQuery получаем ответ после запроса
 func (transactionItem *TransactionStruct) FetchQuery(ctx context.Context, query string, args ...interface{}) (map[string]string, error) {
 
 	// если резервный и запрос меняет бд
-	if server.IsReserveServer() && isWriteRows(query) && !isAllowWriteTable(transactionItem.dbKey, query) {
-		return map[string]string{}, nil
+	if isBlocked, err := checkQueryOnReserve(transactionItem.dbKey, query); isBlocked {
+		return map[string]string{}, err
 	}
 
-	queryContext, cancel := context.WithTimeout(ctx, QueryTimeout)
+	queryContext, cancel := transactionItem.withQueryTimeout(ctx)
 	defer cancel()
 
 	// осуществляем запрос
@@ -529,7 +579,7 @@ func (transactionItem *TransactionStruct) FetchQuery(ctx context.Context, query
 // GetAll получаем массив
 func (transactionItem *TransactionStruct) GetAll(ctx context.Context, query string, args ...interface{}) (map[int]map[string]string, error) {
 
-	queryContext, cancel := context.WithTimeout(ctx, QueryTimeout)
+	queryContext, cancel := transactionItem.withQueryTimeout(ctx)
 	defer cancel()
 
 	// осуществляем запрос
@@ -545,27 +595,74 @@ func (transactionItem *TransactionStruct) GetAll(ctx context.Context, query stri
 	return response, queryItem.err
 }
 
+// FetchQueryTyped получаем ответ после запроса, сохраняя NULL и тип колонок
+func (transactionItem *TransactionStruct) FetchQueryTyped(ctx context.Context, query string, args ...interface{}) (map[string]ValueStruct, error) {
+
+	queryContext, cancel := transactionItem.withQueryTimeout(ctx)
+	defer cancel()
+
+	// осуществляем запрос
+	queryItem, err := transactionItem.sendQueryForFormat(queryContext, query, args...)
+	if err != nil {
+
+		log.Errorf("unable send query with transaction, error: %v", err)
+		return map[string]ValueStruct{}, err
+	}
+
+	response := queryItem.formatFetchTypedQuery()
+	return response, queryItem.err
+}
+
+// GetAllTyped получаем массив, сохраняя NULL и тип колонок
+func (transactionItem *TransactionStruct) GetAllTyped(ctx context.Context, query string, args ...interface{}) (map[int]map[string]ValueStruct, error) {
+
+	queryContext, cancel := transactionItem.withQueryTimeout(ctx)
+	defer cancel()
+
+	// осуществляем запрос
+	queryItem, err := transactionItem.sendQueryForFormat(queryContext, query, args...)
+	if err != nil {
+
+		log.Errorf("unable send query with transaction, error: %v", err)
+		return map[int]map[string]ValueStruct{}, err
+	}
+
+	response := queryItem.formatFetchArrayTypedQuery()
+	return response, queryItem.err
+}
+
 // Update осуществляем запрос update
 func (transactionItem *TransactionStruct) Update(ctx context.Context, query string, args ...interface{}) (int64, error) {
 
+	res, err := transactionItem.execUpdate(ctx, query, args...)
+	if err != nil || res == nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// выполняем запрос на обновление в транзакции, на резервном сервере результат пустой
+func (transactionItem *TransactionStruct) execUpdate(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+
 	// если резервный и запрос меняет бд
-	if server.IsReserveServer() && !isAllowWriteTable(transactionItem.dbKey, query) {
-		return 0, nil
+	if isBlocked, err := checkWriteOnReserve(transactionItem.dbKey, query); isBlocked {
+		return nil, err
 	}
 
-	queryContext, cancel := context.WithTimeout(ctx, QueryTimeout)
+	queryContext, cancel := transactionItem.withQueryTimeout(ctx)
 	defer cancel()
 
 	// проверяем соединение и осуществляем запрос
-	res, err := transactionItem.transaction.ExecContext(queryContext, query, args...)
+	res, err := transactionItem.execWithOutbox(queryContext, outboxChangeStruct{operation: OutboxOperationUpdate}, query, args...)
 	if err != nil {
-		return 0, fmt.Errorf("query: %s, error: %v", query, err)
+		return nil, fmt.Errorf("query: %s, error: %w", query, err)
 	}
 
-	return res.RowsAffected()
+	return res, nil
 }
 
-// Commit подтверждаем транзакцию
+// Commit подтверждаем транзакцию, ошибка возвращается как *CommitError
 func (transactionItem *TransactionStruct) Commit() error {
 
 	// подтверждаем транзакцию
@@ -573,7 +670,12 @@ func (transactionItem *TransactionStruct) Commit() error {
 	if err != nil {
 
 		log.Errorf("unable commit transaction, error: %v", err)
-		return err
+		return &CommitError{Err: err}
+	}
+
+	// изменения стали видны – сбрасываем кэш измененных таблиц
+	for _, query := range transactionItem.writeQueryList {
+		transactionItem.connectionItem.invalidateQueryCache(query)
 	}
 
 	return nil
@@ -597,14 +699,17 @@ func (transactionItem *TransactionStruct) Rollback() error {
 func (transactionItem *TransactionStruct) ExecQuery(ctx context.Context, query string, args ...interface{}) error {
 
 	// если резервный и запрос меняет бд
-	if server.IsReserveServer() && isWriteRows(query) && !isAllowWriteTable(transactionItem.dbKey, query) {
-		return nil
+	if isBlocked, err := checkQueryOnReserve(transactionItem.dbKey, query); isBlocked {
+		return err
 	}
 
+	queryContext, cancel := transactionItem.withQueryTimeout(ctx)
+	defer cancel()
+
 	// осуществляем запрос
-	_, err := transactionItem.transaction.ExecContext(ctx, query, args...)
+	_, err := transactionItem.execContext(queryContext, query, args...)
 	if err != nil {
-		return fmt.Errorf("transaction query: %s, error: %v", query, err)
+		return fmt.Errorf("transaction query: %s, error: %w", query, err)
 	}
 
 	return nil
@@ -614,19 +719,17 @@ func (transactionItem *TransactionStruct) ExecQuery(ctx context.Context, query s
 func (transactionItem *TransactionStruct) sendQueryForFormat(ctx context.Context, query string, args ...interface{}) (*queryStruct, error) {
 
 	// инициализируем объект для обработки ответа
-	queryItem := &queryStruct{}
+	queryItem := &queryStruct{location: transactionItem.connectionItem.getLocation()}
 
 	// если резервный и запрос меняет бд
-	if server.IsReserveServer() && isWriteRows(query) && !isAllowWriteTable(transactionItem.dbKey, query) {
-		return queryItem, nil
+	if isBlocked, err := checkQueryOnReserve(transactionItem.dbKey, query); isBlocked {
+		return queryItem, err
 	}
 
 	// осуществляем запрос
-	queryItem.rows, queryItem.err = transactionItem.transaction.QueryContext(ctx, query, args...)
+	queryItem.rows, queryItem.err = transactionItem.queryContext(ctx, query, args...)
 	if queryItem.err != nil {
-
-		_ = queryItem.rows.Close()
-		return &queryStruct{}, fmt.Errorf("unable send query: '%s', error: %v", query, queryItem.err)
+		return &queryStruct{}, fmt.Errorf("unable send query: '%s', error: %w", query, queryItem.err)
 	}
 
 	// получаем поля таблицы
@@ -634,7 +737,15 @@ func (transactionItem *TransactionStruct) sendQueryForFormat(ctx context.Context
 	if queryItem.err != nil {
 
 		_ = queryItem.rows.Close()
-		return &queryStruct{}, fmt.Errorf("no table field in response, query: '%s', error: %v", query, queryItem.err)
+		return &queryStruct{}, fmt.Errorf("no table field in response, query: '%s', error: %w", query, queryItem.err)
+	}
+
+	// получаем типы полей таблицы
+	queryItem.columnTypeList, queryItem.err = queryItem.rows.ColumnTypes()
+	if queryItem.err != nil {
+
+		_ = queryItem.rows.Close()
+		return &queryStruct{}, fmt.Errorf("no column types in response, query: '%s', error: %w", query, queryItem.err)
 	}
 
 	// создаем массив значений и массив для rows.Scan
@@ -652,6 +763,7 @@ func (transactionItem *TransactionStruct) Insert(ctx context.Context, tableName
 
 	var keys, valueKeys string
 	var values []interface{}
+	data := make(map[string]interface{})
 
 	v := reflect.ValueOf(insert)
 
@@ -662,16 +774,22 @@ func (transactionItem *TransactionStruct) Insert(ctx context.Context, tableName
 	for i := 0; i < v.NumField(); i++ {
 
 		// получаем имя для вставки использования в mysql
-		k, ok := v.Type().Field(i).Tag.Lookup("sqlname")
+		tag, ok := parseSqlTag(v.Type().Field(i))
 
 		// если не нашли - пропускаем
-		if !ok || k == "-" {
+		if !ok {
 			continue
 		}
 
-		keys += fmt.Sprintf("`%s` , ", k)
+		value, err := getSqlFieldValue(v.Field(i), tag)
+		if err != nil {
+			return err
+		}
+
+		keys += fmt.Sprintf("`%s` , ", tag.name)
 		valueKeys += "? , "
-		values = append(values, v.Field(i).Interface())
+		values = append(values, value)
+		data[tag.name] = value
 	}
 
 	keys = strings.TrimSuffix(keys, " , ")
@@ -684,16 +802,17 @@ func (transactionItem *TransactionStruct) Insert(ctx context.Context, tableName
 	query := fmt.Sprintf("INSERT %sINTO %s (%s) VALUES (%s)", ignore, tableName, keys, valueKeys)
 
 	// если резервный и запрос меняет бд
-	if server.IsReserveServer() && !isAllowWriteTable(transactionItem.dbKey, query) {
-		return nil
+	if isBlocked, err := checkWriteOnReserve(transactionItem.dbKey, query); isBlocked {
+		return err
 	}
 
-	queryCtx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	queryCtx, cancel := transactionItem.withQueryTimeout(ctx)
 	defer cancel()
 
-	err := transactionItem.ExecQuery(queryCtx, query, values...)
+	change := outboxChangeStruct{tableName: tableName, operation: OutboxOperationInsert, data: data}
+	_, err := transactionItem.execWithOutbox(queryCtx, change, query, values...)
 	if err != nil {
-		return fmt.Errorf("query: %s, error: %v", query, err)
+		return fmt.Errorf("query: %s, error: %w", query, err)
 	}
 	return nil
 }
@@ -703,8 +822,9 @@ func (transactionItem *TransactionStruct) InsertOrUpdate(ctx context.Context, ta
 
 	var keys, valueKeys, updateKeys string
 	var values []interface{}
-	for k, v := range insert {
+	for _, k := range getSortedKeyList(insert) {
 
+		v := insert[k]
 		keys += fmt.Sprintf("`%s` , ", k)
 		valueKeys += "? , "
 		updateKeys += fmt.Sprintf("`%s` = ? , ", k)
@@ -716,20 +836,21 @@ func (transactionItem *TransactionStruct) InsertOrUpdate(ctx context.Context, ta
 	valueKeys = strings.TrimSuffix(valueKeys, " , ")
 	updateKeys = strings.TrimSuffix(updateKeys, " , ")
 
+	query := fmt.Sprintf("INSERT INTO `%s` (%s) VALUES (%s) on duplicate key update %s;",
+		tableName, keys, valueKeys, updateKeys)
+
 	// если резервный и запрос меняет бд
-	if server.IsReserveServer() && !isAllowWriteTable(transactionItem.dbKey, tableName) {
-		return nil
+	if isBlocked, err := checkWriteOnReserve(transactionItem.dbKey, query); isBlocked {
+		return err
 	}
 
-	queryContext, cancel := context.WithTimeout(ctx, QueryTimeout)
+	queryContext, cancel := transactionItem.withQueryTimeout(ctx)
 	defer cancel()
 
-	query := fmt.Sprintf("INSERT INTO `%s` (%s) VALUES (%s) on duplicate key update %s;",
-		tableName, keys, valueKeys, updateKeys)
-
-	err := transactionItem.ExecQuery(queryContext, query, values...)
+	change := outboxChangeStruct{tableName: tableName, operation: OutboxOperationUpsert, data: insert}
+	_, err := transactionItem.execWithOutbox(queryContext, change, query, values...)
 	if err != nil {
-		return fmt.Errorf("query: %s, error: %v", query, err)
+		return fmt.Errorf("query: %s, error: %w", query, err)
 	}
 	return nil
 }
@@ -745,6 +866,12 @@ func (queryItem *queryStruct) formatFetchArrayQuery() map[int]map[string]string
 
 	// создаем массив ответа и заполняем его
 	resultMap := make(map[int]map[string]string)
+
+	// запрос был заблокирован на резервном сервере
+	if queryItem.rows == nil {
+		return resultMap
+	}
+
 	for i := 0; queryItem.rows.Next(); i++ {
 
 		// сканируем строку и обрабатываем ошибку
@@ -771,6 +898,12 @@ func (queryItem *queryStruct) formatFetchQuery() map[string]string {
 
 	// создаем массив ответа и заполняем его
 	resultMap := make(map[string]string)
+
+	// запрос был заблокирован на резервном сервере
+	if queryItem.rows == nil {
+		return resultMap
+	}
+
 	for queryItem.rows.Next() {
 
 		// сканируем строку и обрабатываем ошибку
@@ -795,6 +928,12 @@ func (queryItem *queryStruct) formatFetchList() []string {
 
 	// создаем массив ответа и заполняем его
 	var resultMap []string
+
+	// запрос был заблокирован на резервном сервере
+	if queryItem.rows == nil {
+		return resultMap
+	}
+
 	for queryItem.rows.Next() {
 
 		// сканируем строку и обрабатываем ошибку
@@ -812,93 +951,98 @@ func (queryItem *queryStruct) formatFetchList() []string {
 	return resultMap
 }
 
-// после fetch query
-func (queryItem *queryStruct) afterFetchQuery() {
+// форматируем запрос в массив, сохраняя NULL и тип колонок
+func (queryItem *queryStruct) formatFetchArrayTypedQuery() map[int]map[string]ValueStruct {
 
-	queryItem.handleError(queryItem.rows.Err())
-	queryItem.handleError(queryItem.rows.Close())
-}
+	defer queryItem.afterFetchQuery()
 
-// обрабатываем ошибку
-func (queryItem *queryStruct) handleError(err error) {
+	// создаем массив ответа и заполняем его
+	resultMap := make(map[int]map[string]ValueStruct)
 
-	if err != nil {
-		queryItem.err = err
+	// запрос был заблокирован на резервном сервере
+	if queryItem.rows == nil {
+		return resultMap
 	}
-}
 
-// проверяет является ли запрос query изменяющим таблицу
-func isWriteRows(query string) bool {
-	query = strings.ToUpper(query)
-
-	writeKeywords := []string{
-		"INSERT", "UPDATE", "DELETE", "REPLACE",
-		"CREATE", "DROP", "ALTER", "TRUNCATE",
-		"LOCK", "UNLOCK",
-	}
+	for i := 0; queryItem.rows.Next(); i++ {
 
-	for _, kw := range writeKeywords {
-		if strings.HasPrefix(query, kw+" ") {
-			return true
+		// сканируем строку и обрабатываем ошибку
+		queryItem.handleError(queryItem.rows.Scan(queryItem.scanList...))
+		if queryItem.err != nil {
+			return nil
 		}
+
+		resultMap[i] = queryItem.getTypedRow()
 	}
 
-	return false
+	return resultMap
 }
 
-// проверяем, что в запросе query есть таблица из allow списка
-func isAllowWriteTable(dbKey string, query string) bool {
+// форматируем запрос, сохраняя NULL и тип колонок
+func (queryItem *queryStruct) formatFetchTypedQuery() map[string]ValueStruct {
 
-	// нормализуем регистр и убираем `, чтобы ловить и `db`.`table`
-	query = strings.ToLower(query)
-	query = strings.ReplaceAll(query, "`", "")
+	defer queryItem.afterFetchQuery()
 
-	allowDbList := []string{
-		"pivot_company_service",
-		"mysql",
-	}
+	// создаем массив ответа и заполняем его
+	resultMap := make(map[string]ValueStruct)
 
-	allowTableList := []string{
-		"domino_registry",
-		"user",
-		"db",
-		"tables_priv",
+	// запрос был заблокирован на резервном сервере
+	if queryItem.rows == nil {
+		return resultMap
 	}
 
-	isDbAllowed, _ := functions.InArray(dbKey, allowDbList)
-	if !isDbAllowed {
-		return false
+	for queryItem.rows.Next() {
+
+		// сканируем строку и обрабатываем ошибку
+		queryItem.handleError(queryItem.rows.Scan(queryItem.scanList...))
+		if queryItem.err != nil {
+			return nil
+		}
+
+		resultMap = queryItem.getTypedRow()
 	}
 
-	for _, pattern := range allowTableList {
+	return resultMap
+}
 
-		// шаблон с %s, например pivot_company_service.table_%s
-		if strings.Contains(pattern, "%s") {
+// получаем текущую отсканированную строку с признаком NULL и типом колонок
+func (queryItem *queryStruct) getTypedRow() map[string]ValueStruct {
 
-			// база до %s, например "table_"
-			base := strings.ReplaceAll(pattern, "%s", "")
+	rowArray := make(map[string]ValueStruct, len(queryItem.valueList))
+	for key, value := range queryItem.valueList {
 
-			// ищем что-то вроде table_d1 / table__d2 и прочее
-			regexStr := `\b` + regexp.QuoteMeta(base) + `[a-z0-9_]+` + `\b`
-			re := regexp.MustCompile(regexStr)
+		databaseType := ""
+		if key < len(queryItem.columnTypeList) {
+			databaseType = queryItem.columnTypeList[key].DatabaseTypeName()
+		}
 
-			if re.MatchString(query) && isDbAllowed {
-				return true
-			}
-			continue
+		rowArray[queryItem.columnList[key]] = ValueStruct{
+			Value:        string(value),
+			IsNull:       value == nil,
+			DatabaseType: databaseType,
 		}
+	}
 
-		// точное имя таблицы из allow
-		regexStr := `\b` + regexp.QuoteMeta(pattern) + `\b`
-		re := regexp.MustCompile(regexStr)
+	return rowArray
+}
 
-		if re.MatchString(query) && isDbAllowed {
-			return true
-		}
+// после fetch query
+func (queryItem *queryStruct) afterFetchQuery() {
+
+	if queryItem.rows == nil {
+		return
 	}
 
-	// не нашли allow-таблицу в запросе
-	return false
+	queryItem.handleError(queryItem.rows.Err())
+	queryItem.handleError(queryItem.rows.Close())
+}
+
+// обрабатываем ошибку
+func (queryItem *queryStruct) handleError(err error) {
+
+	if err != nil {
+		queryItem.err = err
+	}
 }
 
 // готовим запрос для InsertOrUpdate
@@ -916,17 +1060,24 @@ func FormatInsertOrUpdate(tableName string, insert interface{}) (string, []inter
 	for i := 0; i < v.NumField(); i++ {
 
 		// получаем имя для вставки использования в mysql
-		k, ok := v.Type().Field(i).Tag.Lookup("sqlname")
+		tag, ok := parseSqlTag(v.Type().Field(i))
 
 		// если не нашли - пропускаем
-		if !ok || k == "-" {
+		if !ok {
 			continue
 		}
 
-		keys += fmt.Sprintf("`%s` , ", k)
+		value, err := getSqlFieldValue(v.Field(i), tag)
+		if err != nil {
+
+			log.Errorf("unable prepare insert for table `%s`, error: %v", tableName, err)
+			value = v.Field(i).Interface()
+		}
+
+		keys += fmt.Sprintf("`%s` , ", tag.name)
 		valueKeys += "? , "
-		updateKeys += fmt.Sprintf("`%s` = ? , ", k)
-		values = append(values, v.Field(i).Interface())
+		updateKeys += fmt.Sprintf("`%s` = ? , ", tag.name)
+		values = append(values, value)
 	}
 
 	values = append(values, values...)
@@ -939,29 +1090,13 @@ func FormatInsertOrUpdate(tableName string, insert interface{}) (string, []inter
 	return query, values
 }
 
-// готовим запрос для InsertArray
-func InsertArray(tableName string, columnList []string, insertDataList [][]interface{}) (string, []interface{}) {
+// готовим запросы для InsertArray, большой массив делится на пачки
+func InsertArray(tableName string, columnList []string, insertDataList [][]interface{}) ([]BulkQueryStruct, error) {
 
-	var columnString, valueString string
-	for _, column := range columnList {
-		columnString += column + ", "
-	}
-
-	columnString = columnString[:len(columnString)-2]
-
-	var valueList []interface{}
-	for _, insertData := range insertDataList {
-
-		valueString += "("
-		for _, v := range insertData {
-
-			valueString += "?, "
-			valueList = append(valueList, v)
-		}
-		valueString = valueString[:len(valueString)-2] + "), "
+	if len(columnList) == 0 {
+		return nil, fmt.Errorf("insert array into %s without columns", tableName)
 	}
-	valueString = valueString[:len(valueString)-2]
 
-	query := fmt.Sprintf("INSERT IGNORE INTO `%s` (%s) VALUES %s", tableName, columnString, valueString)
-	return query, valueList
+	prefix := fmt.Sprintf("INSERT IGNORE INTO `%s` (%s) VALUES ", tableName, strings.Join(columnList, ", "))
+	return splitBulkInsert(prefix, "", len(columnList), insertDataList, BulkInsertConfigStruct{})
 }
@@ -0,0 +1,158 @@
+package mysqlmock
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	sqlmock "github.com/getCompassUtils/go_base_frame/api/_modules/go-sqlmock"
+	"github.com/getCompassUtils/go_base_frame/api/system/mysql"
+)
+
+// -------------------------------------------------------
+// пакет подмены mysql в тестах сервисов
+// создает пул на sqlmock и регистрирует его под тем же ключом, что и GetMysqlConnection,
+// поэтому код сервиса получает подмененный пул, не зная о тесте
+// ожидания для Insert, InsertOrUpdate и InsertArray строятся в том же виде, что и запросы пакета mysql
+// -------------------------------------------------------
+
+// MockStruct подмененный пул и ожидания к нему
+type MockStruct struct {
+	sqlmock.Sqlmock
+	ConnectionItem *mysql.ConnectionPoolItem
+	db             string
+	host           string
+}
+
+// -------------------------------------------------------
+// PUBLIC
+// -------------------------------------------------------
+
+// New создаем пул на sqlmock и подменяем им пул базы db на хосте host
+func New(db string, host string) (*MockStruct, error) {
+
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		return nil, fmt.Errorf("unable create sqlmock, error: %w", err)
+	}
+
+	return &MockStruct{
+		Sqlmock:        mock,
+		ConnectionItem: mysql.ReplaceHostConnection(db, host, conn),
+		db:             db,
+		host:           host,
+	}, nil
+}
+
+// Close удаляем подмененный пул из хранилища, даже если sqlmock вернул ошибку закрытия
+func (mock *MockStruct) Close() error {
+
+	mock.ExpectClose()
+	return mysql.RemoveMysqlConnectionPool(mock.db, mock.host)
+}
+
+// ExpectInsert ожидаем Insert пула, по умолчанию запрос вставляет одну строку
+func (mock *MockStruct) ExpectInsert(tableName string, insert map[string]interface{}, isIgnore bool) *sqlmock.ExpectedExec {
+
+	keyList, argList := splitInsert(insert)
+
+	ignore := ""
+	if isIgnore {
+		ignore = "IGNORE "
+	}
+	query := fmt.Sprintf("INSERT %sINTO %s (%s) VALUES (%s)", ignore, tableName, joinKeyList(keyList, "`%s`"), getPlaceholderList(len(keyList)))
+
+	return mock.expectExec(query, argList)
+}
+
+// ExpectInsertOrUpdate ожидаем InsertOrUpdate пула или транзакции, по умолчанию запрос вставляет одну строку
+func (mock *MockStruct) ExpectInsertOrUpdate(tableName string, insert map[string]interface{}) *sqlmock.ExpectedExec {
+
+	keyList, argList := splitInsert(insert)
+	query := fmt.Sprintf("INSERT INTO `%s` (%s) VALUES (%s) on duplicate key update %s;",
+		tableName, joinKeyList(keyList, "`%s`"), getPlaceholderList(len(keyList)), joinKeyList(keyList, "`%s` = ?"))
+
+	return mock.expectExec(query, append(argList, argList...))
+}
+
+// ExpectInsertArray ожидаем InsertArray пула, большой массив ожидается теми же пачками, которыми вставляется
+func (mock *MockStruct) ExpectInsertArray(tableName string, columnList []string, insertDataList [][]interface{}) ([]*sqlmock.ExpectedExec, error) {
+
+	queryList, err := mysql.InsertArray(tableName, columnList, insertDataList)
+	if err != nil {
+		return nil, err
+	}
+
+	expectedList := make([]*sqlmock.ExpectedExec, 0, len(queryList))
+	for _, bulkQuery := range queryList {
+
+		rowCount := int64(len(bulkQuery.ArgList) / len(columnList))
+		expectedList = append(expectedList, mock.expectExec(bulkQuery.Query, bulkQuery.ArgList).WillReturnResult(sqlmock.NewResult(0, rowCount)))
+	}
+
+	return expectedList, nil
+}
+
+// SetRow кладем строку в таблицу sqlmock, ее вернет запрос вида SELECT ... FROM `table` WHERE ... с аргументом key
+func (mock *MockStruct) SetRow(tableName string, key interface{}, row map[string]interface{}) {
+
+	columnList, valueList := splitInsert(row)
+
+	rowValueList := make([]driver.Value, 0, len(valueList))
+	for _, value := range valueList {
+		rowValueList = append(rowValueList, value)
+	}
+
+	mock.AddRow(tableName, mock.NewRows(columnList).AddRow(rowValueList...), key)
+}
+
+// -------------------------------------------------------
+// PROTECTED
+// -------------------------------------------------------
+
+// ожидаем запрос на изменение с точным текстом и аргументами
+func (mock *MockStruct) expectExec(query string, argList []interface{}) *sqlmock.ExpectedExec {
+
+	valueList := make([]driver.Value, 0, len(argList))
+	for _, arg := range argList {
+		valueList = append(valueList, arg)
+	}
+
+	return mock.ExpectExec("^" + regexp.QuoteMeta(query) + "$").WithArgs(valueList...).WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+// делим вставку на ключи в алфавитном порядке, как их пишет пакет mysql, и значения
+func splitInsert(insert map[string]interface{}) ([]string, []interface{}) {
+
+	keyList := make([]string, 0, len(insert))
+	for key := range insert {
+		keyList = append(keyList, key)
+	}
+	sort.Strings(keyList)
+
+	argList := make([]interface{}, 0, len(keyList))
+	for _, key := range keyList {
+		argList = append(argList, insert[key])
+	}
+
+	return keyList, argList
+}
+
+// собираем список по ключам через " , ", как его пишет пакет mysql
+func joinKeyList(keyList []string, format string) string {
+
+	partList := make([]string, 0, len(keyList))
+	for _, key := range keyList {
+		partList = append(partList, fmt.Sprintf(format, key))
+	}
+
+	return strings.Join(partList, " , ")
+}
+
+// получаем плейсхолдеры значений через " , "
+func getPlaceholderList(count int) string {
+
+	return strings.TrimSuffix(strings.Repeat("? , ", count), " , ")
+}
@@ -0,0 +1,75 @@
+package mysqlmock
+
+import (
+	"context"
+	"testing"
+
+	"github.com/getCompassUtils/go_base_frame/api/system/mysql"
+)
+
+// проверяем, что ожидания совпадают с запросами, которые строит пакет mysql
+func TestExpectInsert(t *testing.T) {
+
+	mock, err := New("mock_db", "mock_host")
+	if err != nil {
+		t.Fatalf("unable create mock: %v", err)
+	}
+
+	ctx := context.Background()
+	insert := map[string]interface{}{"name": "a", "id": int64(1), "created_at": int64(100)}
+
+	mock.ExpectInsert("user", insert, false)
+	mock.ExpectInsert("user", insert, true)
+	mock.ExpectInsertOrUpdate("user", insert)
+	_, err = mock.ExpectInsertArray("user", []string{"id", "name"}, [][]interface{}{{int64(1), "a"}, {int64(2), "b"}})
+	if err != nil {
+		t.Fatalf("unable expect insert array: %v", err)
+	}
+
+	connectionItem, err := mysql.GetMysqlConnection(ctx, "mock_db", "mock_host", "", "", 1, false)
+	if err != nil || connectionItem != mock.ConnectionItem {
+		t.Fatalf("mock is not returned by GetMysqlConnection, error: %v", err)
+	}
+
+	if _, err = connectionItem.Insert(ctx, "user", insert, false); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	if _, err = connectionItem.Insert(ctx, "user", insert, true); err != nil {
+		t.Fatalf("insert ignore: %v", err)
+	}
+	if err = connectionItem.InsertOrUpdate(ctx, "user", insert); err != nil {
+		t.Fatalf("insert or update: %v", err)
+	}
+	if err = connectionItem.InsertArray(ctx, "user", []string{"id", "name"}, [][]interface{}{{int64(1), "a"}, {int64(2), "b"}}); err != nil {
+		t.Fatalf("insert array: %v", err)
+	}
+
+	if err = mock.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
+
+// проверяем, что после Close пул убран из хранилища, даже если закрытие вернуло ошибку
+func TestCloseRemovesPool(t *testing.T) {
+
+	mock, err := New("mock_db", "mock_host")
+	if err != nil {
+		t.Fatalf("unable create mock: %v", err)
+	}
+
+	// нарушаем порядок ожиданий, чтобы закрытие sqlmock вернуло ошибку
+	mock.ExpectExec("never")
+	if err = mock.Close(); err == nil {
+		t.Fatalf("expected close error")
+	}
+
+	for _, info := range mysql.GetConnectionPoolList() {
+
+		if info.Key == "mock_host-mock_db" {
+			t.Fatalf("pool is left in storage after failed close")
+		}
+	}
+}
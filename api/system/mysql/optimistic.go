@@ -0,0 +1,219 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// -------------------------------------------------------
+// обновление с оптимистичной блокировкой
+// строка обновляется, только если версия в базе совпадает с версией в структуре,
+// при успехе версия увеличивается и записывается обратно в структуру
+// колонки описываются тегом sqlname:
+// опция pk помечает колонки первичного ключа, опция version – колонку версии
+// целочисленная версия увеличивается на 1, версия типа time.Time заменяется текущим временем с точностью до секунды,
+// поэтому колонка версии может быть обычным DATETIME или TIMESTAMP
+// -------------------------------------------------------
+
+const (
+	sqlTagOptionPrimaryKey = "pk"      // колонка первичного ключа
+	sqlTagOptionVersion    = "version" // колонка версии
+)
+
+// ErrVersionConflict строку изменили после того, как ее прочитали
+var ErrVersionConflict = errors.New("version conflict")
+
+// VersionConflictError ошибка обновления устаревшей версии строки
+type VersionConflictError struct {
+	TableName string      // таблица
+	Version   interface{} // версия, с которой пытались обновить строку
+}
+
+// запрос на обновление версионной строки
+type versionedUpdateStruct struct {
+	query      string
+	argList    []interface{}
+	version    interface{}   // текущая версия из структуры
+	newVersion reflect.Value // новая версия, записывается в структуру после обновления
+	field      reflect.Value // поле версии в структуре
+}
+
+// -------------------------------------------------------
+// PUBLIC
+// -------------------------------------------------------
+
+// Error текст ошибки
+func (conflictError *VersionConflictError) Error() string {
+
+	return fmt.Sprintf("%v: table `%s`, version %v", ErrVersionConflict, conflictError.TableName, conflictError.Version)
+}
+
+// Unwrap позволяет проверять ошибку через errors.Is(err, ErrVersionConflict)
+func (conflictError *VersionConflictError) Unwrap() error {
+
+	return ErrVersionConflict
+}
+
+// UpdateVersioned обновляем строку, если ее версия не изменилась, row – указатель на структуру с тегами sqlname
+// при совпадении версии новая версия записывается в row, иначе возвращается *VersionConflictError
+func (connectionItem *ConnectionPoolItem) UpdateVersioned(ctx context.Context, tableName string, row interface{}) error {
+
+	return updateVersioned(ctx, connectionItem.execUpdate, tableName, row)
+}
+
+// UpdateVersioned обновляем строку в транзакции, если ее версия не изменилась
+func (transactionItem *TransactionStruct) UpdateVersioned(ctx context.Context, tableName string, row interface{}) error {
+
+	return updateVersioned(ctx, transactionItem.execUpdate, tableName, row)
+}
+
+// -------------------------------------------------------
+// PROTECTED
+// -------------------------------------------------------
+
+// обновляем строку через переданную функцию запроса
+func updateVersioned(ctx context.Context, exec func(ctx context.Context, query string, args ...interface{}) (sql.Result, error), tableName string, row interface{}) error {
+
+	versionedUpdate, err := formatVersionedUpdate(tableName, row)
+	if err != nil {
+		return err
+	}
+
+	// пустой результат – запись заблокирована на резервном сервере, это не конфликт версий
+	res, err := exec(ctx, versionedUpdate.query, versionedUpdate.argList...)
+	if err != nil || res == nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return &VersionConflictError{TableName: tableName, Version: versionedUpdate.version}
+	}
+
+	versionedUpdate.field.Set(versionedUpdate.newVersion)
+	return nil
+}
+
+// готовим запрос обновления с проверкой версии
+// колонки собираются так же, как в UpdateStruct: с полями встроенных структур и без пустых колонок omitempty,
+// колонка версии пишется всегда
+func formatVersionedUpdate(tableName string, row interface{}) (versionedUpdateStruct, error) {
+
+	v := reflect.ValueOf(row)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return versionedUpdateStruct{}, fmt.Errorf("row must be a pointer to struct, got %T", row)
+	}
+	v = v.Elem()
+
+	quotedTableName, err := quoteIdentifier(tableName)
+	if err != nil {
+		return versionedUpdateStruct{}, err
+	}
+
+	var setList, whereList []string
+	var setArgList, whereArgList []interface{}
+	var versionedUpdate versionedUpdateStruct
+	var versionColumn string
+
+	for _, structField := range getStructFieldList(v.Type()) {
+
+		tag := structField.tag
+		field := v.FieldByIndex(structField.index)
+		isVersion := tag.optionList[sqlTagOptionVersion]
+		if !isVersion && tag.optionList[sqlTagOptionOmitEmpty] && field.IsZero() {
+			continue
+		}
+
+		column, err := quoteIdentifier(tag.name)
+		if err != nil {
+			return versionedUpdateStruct{}, fmt.Errorf("struct %s: %w", v.Type(), err)
+		}
+
+		value, err := getSqlFieldValue(field, tag)
+		if err != nil {
+			return versionedUpdateStruct{}, err
+		}
+
+		switch {
+		case isVersion:
+
+			if versionColumn != "" {
+				return versionedUpdateStruct{}, fmt.Errorf("struct %s has more than one version column", v.Type())
+			}
+
+			newVersion, err := getNextVersion(field)
+			if err != nil {
+				return versionedUpdateStruct{}, fmt.Errorf("column %s: %w", column, err)
+			}
+
+			versionColumn = column
+			versionedUpdate.version = value
+			versionedUpdate.newVersion = newVersion
+			versionedUpdate.field = field
+		case tag.optionList[sqlTagOptionPrimaryKey]:
+
+			whereList = append(whereList, fmt.Sprintf("%s = ?", column))
+			whereArgList = append(whereArgList, value)
+		default:
+
+			setList = append(setList, fmt.Sprintf("%s = ?", column))
+			setArgList = append(setArgList, value)
+		}
+	}
+
+	if len(whereList) == 0 {
+		return versionedUpdateStruct{}, fmt.Errorf("struct %s has no primary key column", v.Type())
+	}
+	if versionColumn == "" {
+		return versionedUpdateStruct{}, fmt.Errorf("struct %s has no version column", v.Type())
+	}
+
+	setList = append(setList, fmt.Sprintf("%s = ?", versionColumn))
+	setArgList = append(setArgList, versionedUpdate.newVersion.Interface())
+	whereList = append(whereList, fmt.Sprintf("%s = ?", versionColumn))
+	whereArgList = append(whereArgList, versionedUpdate.version)
+
+	versionedUpdate.query = fmt.Sprintf("UPDATE %s SET %s WHERE %s LIMIT 1",
+		quotedTableName, strings.Join(setList, ", "), strings.Join(whereList, " AND "))
+	versionedUpdate.argList = append(setArgList, whereArgList...)
+
+	return versionedUpdate, nil
+}
+
+// получаем следующую версию: число увеличиваем, время заменяем текущим
+func getNextVersion(field reflect.Value) (reflect.Value, error) {
+
+	next := reflect.New(field.Type()).Elem()
+
+	switch field.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		next.SetInt(field.Int() + 1)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		next.SetUint(field.Uint() + 1)
+	default:
+
+		if field.Type() != timeType {
+			return reflect.Value{}, fmt.Errorf("unsupported version type %s", field.Type())
+		}
+
+		// DATETIME и TIMESTAMP без дробной части отбрасывают доли секунды, и сравнение с базой не совпало бы
+		// новая версия всегда больше текущей, иначе два обновления за одну секунду дали бы одну и ту же версию
+		current := field.Interface().(time.Time)
+		version := time.Now().Truncate(time.Second)
+		if !version.After(current) {
+			version = current.Truncate(time.Second).Add(time.Second)
+		}
+		next.Set(reflect.ValueOf(version))
+	}
+
+	return next, nil
+}
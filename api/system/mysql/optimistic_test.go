@@ -0,0 +1,81 @@
+package mysql
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// проверяем, что версия-время хранится в секундах и всегда растет
+func TestGetNextTimeVersion(t *testing.T) {
+
+	now := time.Now()
+	caseList := []struct {
+		name    string
+		current time.Time
+	}{
+		{"zero", time.Time{}},
+		{"previous second", now.Add(-time.Second)},
+		{"same second", now.Truncate(time.Second)},
+		{"with microseconds", now.Add(time.Microsecond)},
+		{"future", now.Add(time.Hour)},
+	}
+
+	for _, c := range caseList {
+
+		t.Run(c.name, func(t *testing.T) {
+
+			next, err := getNextVersion(reflect.ValueOf(c.current))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			version := next.Interface().(time.Time)
+			if !version.Equal(version.Truncate(time.Second)) {
+				t.Fatalf("version %v has fraction of second", version)
+			}
+			if !version.After(c.current) {
+				t.Fatalf("version %v is not after current %v", version, c.current)
+			}
+		})
+	}
+}
+
+// проверяем запрос обновления с проверкой версии
+func TestFormatVersionedUpdate(t *testing.T) {
+
+	type baseStruct struct {
+		Id      int64 `sqlname:"id,pk"`
+		Version int64 `sqlname:"version,version,omitempty"`
+	}
+
+	type userStruct struct {
+		baseStruct
+		Name  string `sqlname:"name"`
+		Email string `sqlname:"email,omitempty"`
+	}
+
+	versionedUpdate, err := formatVersionedUpdate("db.user", &userStruct{baseStruct: baseStruct{Id: 1}, Name: "a"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	query := "UPDATE `db`.`user` SET `name` = ?, `version` = ? WHERE `id` = ? AND `version` = ? LIMIT 1"
+	if versionedUpdate.query != query {
+		t.Fatalf("query = %q, want %q", versionedUpdate.query, query)
+	}
+	argList := []interface{}{"a", int64(1), int64(1), int64(0)}
+	if !reflect.DeepEqual(versionedUpdate.argList, argList) {
+		t.Fatalf("argList = %v, want %v", versionedUpdate.argList, argList)
+	}
+
+	if _, err = formatVersionedUpdate("user`; --", &userStruct{}); err == nil {
+		t.Fatalf("expected error for incorrect table")
+	}
+	if _, err = formatVersionedUpdate("user", &struct {
+		baseStruct
+		Name string `sqlname:"name = 1, x"`
+	}{}); err == nil {
+		t.Fatalf("expected error for incorrect column")
+	}
+}
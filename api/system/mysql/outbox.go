@@ -0,0 +1,246 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/getCompassUtils/go_base_frame/api/system/functions"
+)
+
+// -------------------------------------------------------
+// outbox – журнал изменений таблиц
+// запись через Insert, InsertOrUpdate и Update в отмеченные таблицы в той же транзакции
+// добавляет событие в таблицу outbox, откуда его забирает и публикует пакет mysql/outbox
+// вне транзакции запись и событие выполняются в отдельной транзакции
+// -------------------------------------------------------
+
+// DefaultOutboxTableName таблица outbox по умолчанию
+const DefaultOutboxTableName = "outbox"
+
+// операции в событии изменения
+const (
+	OutboxOperationInsert = "insert"
+	OutboxOperationUpsert = "upsert"
+	OutboxOperationUpdate = "update"
+)
+
+// OutboxConfigStruct настройки outbox пула
+type OutboxConfigStruct struct {
+	TableName string   // таблица outbox, по умолчанию outbox
+	TableList []string // таблицы, изменения которых попадают в outbox
+}
+
+// ChangeEventStruct событие изменения таблицы
+// для вставки передаются записанные колонки, для Update – запрос и его аргументы
+// событие Update описывает запрос целиком, а не строки: первичные ключи измененных строк в нем не передаются,
+// потребителю, которому нужны строки, следует перечитать их по условию запроса
+type ChangeEventStruct struct {
+	Id           int64                  `json:"id"`
+	Db           string                 `json:"db"`
+	TableName    string                 `json:"table_name"`
+	Operation    string                 `json:"operation"`
+	Data         map[string]interface{} `json:"data,omitempty"`
+	Query        string                 `json:"query,omitempty"`
+	ArgList      []interface{}          `json:"arg_list,omitempty"`
+	RowsAffected int64                  `json:"rows_affected"`
+	CreatedAt    int64                  `json:"created_at"`
+}
+
+// настройки outbox пула
+type outboxStruct struct {
+	tableName       string
+	quotedTableName string
+	tableMap        map[string]bool
+}
+
+// изменение, которое нужно записать в outbox
+type outboxChangeStruct struct {
+	tableName string // пустое – таблицы берутся из запроса
+	operation string
+	data      map[string]interface{}
+}
+
+// -------------------------------------------------------
+// PUBLIC
+// -------------------------------------------------------
+
+// SetOutbox включаем outbox для таблиц пула, пустой TableList – выключаем
+func (connectionItem *ConnectionPoolItem) SetOutbox(config OutboxConfigStruct) error {
+
+	if len(config.TableList) == 0 {
+
+		connectionItem.outbox.Store(nil)
+		return nil
+	}
+
+	outbox := &outboxStruct{tableName: config.TableName, tableMap: make(map[string]bool)}
+	if outbox.tableName == "" {
+		outbox.tableName = DefaultOutboxTableName
+	}
+
+	var err error
+	outbox.quotedTableName, err = quoteIdentifier(outbox.tableName)
+	if err != nil {
+		return fmt.Errorf("outbox table: %w", err)
+	}
+
+	for _, tableName := range config.TableList {
+
+		// изменения самой таблицы outbox в нее не пишем, иначе удаление опубликованных событий породит новые
+		tableName = connectionItem.normalizeTableName(tableName)
+		if tableName != connectionItem.normalizeTableName(outbox.tableName) {
+			outbox.tableMap[tableName] = true
+		}
+	}
+
+	connectionItem.outbox.Store(outbox)
+	return nil
+}
+
+// GetOutboxTableName получаем таблицу outbox пула
+func (connectionItem *ConnectionPoolItem) GetOutboxTableName() string {
+
+	if outbox := connectionItem.outbox.Load(); outbox != nil {
+		return outbox.tableName
+	}
+
+	return DefaultOutboxTableName
+}
+
+// GetOutboxQuotedTableName получаем таблицу outbox пула в обратных кавычках, проверенную в SetOutbox
+func (connectionItem *ConnectionPoolItem) GetOutboxQuotedTableName() string {
+
+	if outbox := connectionItem.outbox.Load(); outbox != nil {
+		return outbox.quotedTableName
+	}
+
+	return "`" + DefaultOutboxTableName + "`"
+}
+
+// CreateOutboxTable создаем таблицу outbox, если ее нет
+func (connectionItem *ConnectionPoolItem) CreateOutboxTable(ctx context.Context) error {
+
+	query := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s ("+
+		"`id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT, "+
+		"`table_name` VARCHAR(128) NOT NULL, "+
+		"`operation` VARCHAR(16) NOT NULL, "+
+		"`payload` MEDIUMTEXT NOT NULL, "+
+		"`created_at` INT UNSIGNED NOT NULL, "+
+		"PRIMARY KEY (`id`))", connectionItem.GetOutboxQuotedTableName())
+
+	return connectionItem.Query(ctx, query)
+}
+
+// -------------------------------------------------------
+// PROTECTED
+// -------------------------------------------------------
+
+// выполняем запрос на запись через пул, для таблиц с outbox – в транзакции вместе с событием
+func (connectionItem *ConnectionPoolItem) execWithOutbox(ctx context.Context, change outboxChangeStruct, query string, args ...interface{}) (sql.Result, error) {
+
+	if len(connectionItem.getOutboxTableList(change, query)) == 0 {
+		return connectionItem.execContext(ctx, query, args...)
+	}
+
+	var result sql.Result
+	err := connectionItem.RunInTransaction(ctx, nil, func(transactionItem *TransactionStruct) error {
+
+		var err error
+		result, err = transactionItem.execWithOutbox(ctx, change, query, args...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// выполняем запрос на запись в транзакции и добавляем событие в outbox, если запрос изменил строки
+func (transactionItem *TransactionStruct) execWithOutbox(ctx context.Context, change outboxChangeStruct, query string, args ...interface{}) (sql.Result, error) {
+
+	result, err := transactionItem.execContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	tableList := transactionItem.connectionItem.getOutboxTableList(change, query)
+	rowsAffected := getResultRowsAffected(result)
+	if len(tableList) == 0 || rowsAffected == 0 {
+		return result, nil
+	}
+
+	outbox := transactionItem.connectionItem.outbox.Load()
+	outboxQuery := fmt.Sprintf("INSERT INTO %s (`table_name`, `operation`, `payload`, `created_at`) VALUES (?, ?, ?, ?)",
+		outbox.quotedTableName)
+
+	for _, tableName := range tableList {
+
+		event := ChangeEventStruct{
+			Db:           transactionItem.dbKey,
+			TableName:    tableName,
+			Operation:    change.operation,
+			Data:         change.data,
+			RowsAffected: rowsAffected,
+			CreatedAt:    functions.GetCurrentTimeStamp(),
+		}
+
+		// из запроса Update измененные колонки не восстановить – передаем сам запрос
+		if change.data == nil {
+
+			event.Query = query
+			event.ArgList = args
+		}
+
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return nil, fmt.Errorf("unable encode change of table `%s` for outbox, error: %w", tableName, err)
+		}
+
+		_, err = transactionItem.execContext(ctx, outboxQuery, tableName, change.operation, string(payload), event.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("unable write change of table `%s` to outbox, error: %w", tableName, err)
+		}
+	}
+
+	return result, nil
+}
+
+// получаем таблицы изменения, для которых включен outbox
+func (connectionItem *ConnectionPoolItem) getOutboxTableList(change outboxChangeStruct, query string) []string {
+
+	if connectionItem == nil {
+		return nil
+	}
+
+	outbox := connectionItem.outbox.Load()
+	if outbox == nil {
+		return nil
+	}
+
+	tableList := []string{change.tableName}
+	if change.tableName == "" {
+		tableList = parseStatement(query).tableList
+	}
+
+	var outboxTableList []string
+	for _, tableName := range tableList {
+
+		tableName = connectionItem.normalizeTableName(tableName)
+		if outbox.tableMap[tableName] {
+			outboxTableList = append(outboxTableList, tableName)
+		}
+	}
+
+	return outboxTableList
+}
+
+// приводим имя таблицы к виду без кавычек и без базы пула
+func (connectionItem *ConnectionPoolItem) normalizeTableName(tableName string) string {
+
+	tableName = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(tableName), "`", ""))
+	return strings.TrimPrefix(tableName, strings.ToLower(connectionItem.dbKey)+".")
+}
@@ -0,0 +1,236 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getCompassUtils/go_base_frame/api/system/log"
+	"github.com/getCompassUtils/go_base_frame/api/system/mysql"
+	"github.com/getCompassUtils/go_base_frame/api/system/rabbit"
+	"github.com/getCompassUtils/go_base_frame/api/system/server"
+)
+
+// -------------------------------------------------------
+// пакет публикации событий из таблицы outbox
+// relay забирает события пачками по возрастанию id, публикует их в обменник rabbit
+// и удаляет только после подтверждения брокера, поэтому событие доставляется хотя бы один раз
+// и может прийти повторно – получатель должен обрабатывать его идемпотентно по id
+// публикует только один экземпляр сервиса, остальные пропускают проход, пока блокировка занята
+// -------------------------------------------------------
+
+const (
+	defaultBatchSize = 100         // сколько событий публикуем за раз
+	defaultInterval  = time.Second // как часто проверяем outbox
+)
+
+// PublisherInterface отправка сообщений с подтверждением, реализуется *rabbit.ConnectionStruct
+type PublisherInterface interface {
+	PublishMessageListToExchange(exchangeName string, messageList [][]byte) error
+}
+
+// проверяем, что соединение rabbit подходит для публикации
+var _ PublisherInterface = (*rabbit.ConnectionStruct)(nil)
+
+// ConfigStruct конфигурация relay
+type ConfigStruct struct {
+	ExchangeName string        // обменник, в который публикуются события
+	BatchSize    int           // сколько событий публикуем за раз, по умолчанию 100
+	Interval     time.Duration // как часто проверяем outbox, по умолчанию 1 секунда
+	LockName     string        // имя блокировки, по умолчанию outbox_<таблица>; задайте свое, если на сервере несколько баз с outbox
+}
+
+// RelayStruct публикация событий outbox пула
+type RelayStruct struct {
+	connectionItem *mysql.ConnectionPoolItem
+	publisher      PublisherInterface
+	config         ConfigStruct
+	mu             sync.Mutex
+	stopChan       chan struct{}
+}
+
+// строка таблицы outbox
+type outboxRowStruct struct {
+	Id      int64  `sqlname:"id"`
+	Payload string `sqlname:"payload"`
+}
+
+// -------------------------------------------------------
+// PUBLIC
+// -------------------------------------------------------
+
+// NewRelay создаем relay для outbox пула
+func NewRelay(connectionItem *mysql.ConnectionPoolItem, publisher PublisherInterface, config ConfigStruct) *RelayStruct {
+
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaultBatchSize
+	}
+	if config.Interval <= 0 {
+		config.Interval = defaultInterval
+	}
+	if config.LockName == "" {
+		config.LockName = "outbox_" + connectionItem.GetOutboxTableName()
+	}
+
+	return &RelayStruct{connectionItem: connectionItem, publisher: publisher, config: config}
+}
+
+// Start запускаем фоновую публикацию, повторный вызов ничего не делает
+func (relay *RelayStruct) Start() {
+
+	relay.mu.Lock()
+	defer relay.mu.Unlock()
+
+	if relay.stopChan != nil {
+		return
+	}
+
+	relay.stopChan = make(chan struct{})
+	go relay.listen(relay.stopChan)
+}
+
+// Stop останавливаем фоновую публикацию
+func (relay *RelayStruct) Stop() {
+
+	relay.mu.Lock()
+	defer relay.mu.Unlock()
+
+	if relay.stopChan == nil {
+		return
+	}
+
+	close(relay.stopChan)
+	relay.stopChan = nil
+}
+
+// Flush публикуем все накопившиеся события сейчас, возвращаем количество опубликованных
+// если публикует другой экземпляр – ничего не делаем
+func (relay *RelayStruct) Flush(ctx context.Context) (int, error) {
+
+	// на резервном сервере события не удаляются, значит и не публикуются
+	if server.IsReserveServer() {
+		return 0, nil
+	}
+
+	lock, err := relay.connectionItem.TryLock(ctx, relay.config.LockName)
+	if errors.Is(err, mysql.ErrLockNotAcquired) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+
+		err := lock.Release()
+		if err != nil {
+			log.Errorf("unable release outbox lock %s, error: %v", relay.config.LockName, err)
+		}
+	}()
+
+	publishedCount := 0
+	for {
+
+		// без блокировки параллельно может публиковать другой экземпляр
+		if lock.IsLost() {
+			return publishedCount, mysql.ErrLockLost
+		}
+
+		count, err := relay.publishBatch(ctx)
+		publishedCount += count
+		if err != nil || count < relay.config.BatchSize {
+			return publishedCount, err
+		}
+	}
+}
+
+// -------------------------------------------------------
+// PROTECTED
+// -------------------------------------------------------
+
+// периодически публикуем события
+func (relay *RelayStruct) listen(stopChan chan struct{}) {
+
+	ticker := time.NewTicker(relay.config.Interval)
+	defer ticker.Stop()
+
+	for {
+
+		select {
+		case <-stopChan:
+			return
+		case <-ticker.C:
+
+			_, err := relay.Flush(context.Background())
+			if err != nil {
+				log.Errorf("unable publish outbox %s, error: %v", relay.connectionItem.GetOutboxTableName(), err)
+			}
+		}
+	}
+}
+
+// публикуем пачку событий и удаляем опубликованные
+func (relay *RelayStruct) publishBatch(ctx context.Context) (int, error) {
+
+	tableName := relay.connectionItem.GetOutboxQuotedTableName()
+	rowList, err := mysql.FetchAll[outboxRowStruct](ctx, relay.connectionItem,
+		fmt.Sprintf("SELECT `id`, `payload` FROM %s ORDER BY `id` LIMIT ?", tableName), relay.config.BatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("unable get outbox events, error: %w", err)
+	}
+
+	if len(rowList) == 0 {
+		return 0, nil
+	}
+
+	messageList := make([][]byte, 0, len(rowList))
+	argList := make([]interface{}, 0, len(rowList))
+	for _, row := range rowList {
+
+		messageList = append(messageList, formatMessage(row))
+		argList = append(argList, row.Id)
+	}
+
+	err = relay.publisher.PublishMessageListToExchange(relay.config.ExchangeName, messageList)
+	if err != nil {
+		return 0, fmt.Errorf("unable publish outbox events, error: %w", err)
+	}
+
+	// если удалить не получилось, события будут опубликованы повторно
+	placeholderList := strings.TrimSuffix(strings.Repeat("?, ", len(argList)), ", ")
+	_, err = relay.connectionItem.Update(ctx, fmt.Sprintf("DELETE FROM %s WHERE `id` IN (%s)", tableName, placeholderList), argList...)
+	if err != nil {
+		return 0, fmt.Errorf("unable delete published outbox events, error: %w", err)
+	}
+
+	return len(rowList), nil
+}
+
+// получаем сообщение события с его id
+func formatMessage(row outboxRowStruct) []byte {
+
+	// числа оставляем как есть, чтобы большие id не потеряли точность
+	decoder := json.NewDecoder(strings.NewReader(row.Payload))
+	decoder.UseNumber()
+
+	var event mysql.ChangeEventStruct
+	err := decoder.Decode(&event)
+	if err != nil {
+
+		log.Errorf("unable decode outbox event %d, publishing as is, error: %v", row.Id, err)
+		return []byte(row.Payload)
+	}
+	event.Id = row.Id
+
+	message, err := json.Marshal(event)
+	if err != nil {
+
+		log.Errorf("unable encode outbox event %d, publishing as is, error: %v", row.Id, err)
+		return []byte(row.Payload)
+	}
+
+	return message
+}
@@ -0,0 +1,37 @@
+package mysql
+
+import (
+	"testing"
+)
+
+// проверяем, что outbox не принимает некорректное имя таблицы
+func TestSetOutboxTableName(t *testing.T) {
+
+	connectionItem := &ConnectionPoolItem{dbKey: "company"}
+
+	err := connectionItem.SetOutbox(OutboxConfigStruct{TableName: "outbox; DROP TABLE user", TableList: []string{"user"}})
+	if err == nil {
+		t.Fatalf("expected error for incorrect outbox table")
+	}
+
+	err = connectionItem.SetOutbox(OutboxConfigStruct{TableList: []string{"`company`.`user`", "outbox"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tableList := connectionItem.getOutboxTableList(outboxChangeStruct{}, "UPDATE company.user SET name = 'a'")
+	if len(tableList) != 1 || tableList[0] != "user" {
+		t.Fatalf("tableList = %v, want [user]", tableList)
+	}
+	if connectionItem.GetOutboxTableName() != DefaultOutboxTableName {
+		t.Fatalf("table name = %s, want %s", connectionItem.GetOutboxTableName(), DefaultOutboxTableName)
+	}
+	if connectionItem.GetOutboxQuotedTableName() != "`outbox`" {
+		t.Fatalf("quoted table name = %s, want `outbox`", connectionItem.GetOutboxQuotedTableName())
+	}
+
+	err = connectionItem.SetOutbox(OutboxConfigStruct{TableName: "company.outbox_event", TableList: []string{"user"}})
+	if err != nil || connectionItem.GetOutboxQuotedTableName() != "`company`.`outbox_event`" {
+		t.Fatalf("quoted table name = %s, err = %v", connectionItem.GetOutboxQuotedTableName(), err)
+	}
+}
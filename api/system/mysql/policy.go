@@ -0,0 +1,238 @@
+package mysql
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"github.com/getCompassUtils/go_base_frame/api/system/fileutils"
+	"github.com/getCompassUtils/go_base_frame/api/system/server"
+)
+
+// -------------------------------------------------------
+// политика записи на резервном сервере
+// на резервном сервере запись разрешена только в таблицы из политики,
+// остальные запросы на запись не выполняются
+// -------------------------------------------------------
+
+const (
+	ReserveWriteModeSilent = 0 // заблокированная запись возвращает успех без изменений, как раньше
+	ReserveWriteModeError  = 1 // заблокированная запись возвращает ErrWriteBlockedOnReserve
+)
+
+// ErrWriteBlockedOnReserve запись не выполнена, так как сервер резервный
+var ErrWriteBlockedOnReserve = errors.New("write blocked on reserve server")
+
+// WritePolicyInterface решает, можно ли выполнить запрос на запись на резервном сервере
+type WritePolicyInterface interface {
+	IsAllowWrite(dbKey string, query string) bool
+}
+
+// WritePolicyConfigStruct конфигурация политики записи
+// ключ – база данных или шаблон базы, значение – список шаблонов таблиц
+// в шаблонах поддерживается * (как в path.Match) и %s (любой непустой суффикс из [a-z0-9_])
+// таблица, указанная в запросе как db.table, проверяется по шаблонам базы db
+type WritePolicyConfigStruct struct {
+	DatabaseList map[string][]string `json:"database_list"`
+}
+
+// ConfigWritePolicyStruct политика записи, построенная по конфигурации
+type ConfigWritePolicyStruct struct {
+	databaseList map[string][]*regexp.Regexp
+}
+
+// политика по умолчанию, совпадает с прежним зашитым списком
+var defaultWritePolicyConfig = WritePolicyConfigStruct{
+	DatabaseList: map[string][]string{
+		"pivot_company_service": {"domino_registry", "user", "db", "tables_priv"},
+		"mysql":                 {"domino_registry", "user", "db", "tables_priv"},
+	},
+}
+
+// хранилище текущей политики и режима блокировки
+var writePolicyStore atomic.Value
+var reserveWriteMode atomic.Int32
+
+// обертка, чтобы atomic.Value всегда хранил один тип
+type writePolicyHolderStruct struct {
+	policy WritePolicyInterface
+}
+
+// выполняется при инициализации пакета
+func init() {
+
+	writePolicyStore.Store(writePolicyHolderStruct{policy: NewConfigWritePolicy(defaultWritePolicyConfig)})
+}
+
+// -------------------------------------------------------
+// PUBLIC
+// -------------------------------------------------------
+
+// SetWritePolicy устанавливаем политику записи на резервном сервере, nil возвращает политику по умолчанию
+func SetWritePolicy(policy WritePolicyInterface) {
+
+	if policy == nil {
+		policy = NewConfigWritePolicy(defaultWritePolicyConfig)
+	}
+
+	writePolicyStore.Store(writePolicyHolderStruct{policy: policy})
+}
+
+// SetReserveWriteMode устанавливаем, что возвращать при заблокированной записи
+func SetReserveWriteMode(mode int) {
+
+	reserveWriteMode.Store(int32(mode))
+}
+
+// NewConfigWritePolicy создаем политику записи из конфигурации
+func NewConfigWritePolicy(config WritePolicyConfigStruct) *ConfigWritePolicyStruct {
+
+	policy := &ConfigWritePolicyStruct{databaseList: make(map[string][]*regexp.Regexp)}
+	for database, tablePatternList := range config.DatabaseList {
+
+		for _, pattern := range tablePatternList {
+			policy.databaseList[strings.ToLower(database)] = append(policy.databaseList[strings.ToLower(database)], compileTablePattern(pattern))
+		}
+	}
+
+	return policy
+}
+
+// LoadWritePolicyConfig загружаем конфигурацию политики записи из json файла
+func LoadWritePolicyConfig(workDir string, fileName string) (WritePolicyConfigStruct, error) {
+
+	var config WritePolicyConfigStruct
+
+	file, err := fileutils.Init(workDir, fileName)
+	if err != nil {
+		return config, fmt.Errorf("unable open write policy config, error: %w", err)
+	}
+
+	content, err := file.Read()
+	if err != nil {
+		return config, fmt.Errorf("unable read write policy config, error: %w", err)
+	}
+
+	err = json.Unmarshal([]byte(content), &config)
+	if err != nil {
+		return config, fmt.Errorf("unable decode write policy config, error: %w", err)
+	}
+
+	return config, nil
+}
+
+// IsAllowWrite проверяем, что все таблицы, которые меняет запрос, разрешены для базы
+func (policy *ConfigWritePolicyStruct) IsAllowWrite(dbKey string, query string) bool {
+
+	// не смогли определить изменяемые таблицы – запрещаем
+	statement := parseStatement(query)
+	if len(statement.tableList) == 0 {
+		return false
+	}
+
+	for _, table := range statement.tableList {
+
+		if !policy.isAllowTable(strings.ToLower(dbKey), table) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// -------------------------------------------------------
+// PROTECTED
+// -------------------------------------------------------
+
+// проверяем, что таблица разрешена, таблица с префиксом базы проверяется по этой базе
+func (policy *ConfigWritePolicyStruct) isAllowTable(dbKey string, table string) bool {
+
+	if index := strings.LastIndex(table, "."); index >= 0 {
+
+		dbKey = table[:index]
+		table = table[index+1:]
+	}
+
+	for _, re := range policy.getTablePatternList(dbKey) {
+
+		if re.MatchString(table) {
+			return true
+		}
+	}
+
+	// не нашли allow-таблицу
+	return false
+}
+
+// получаем шаблоны таблиц для базы, включая шаблоны баз со *
+func (policy *ConfigWritePolicyStruct) getTablePatternList(dbKey string) []*regexp.Regexp {
+
+	var tablePatternList []*regexp.Regexp
+	for database, patternList := range policy.databaseList {
+
+		isMatched, _ := path.Match(database, dbKey)
+		if database == dbKey || isMatched {
+			tablePatternList = append(tablePatternList, patternList...)
+		}
+	}
+
+	return tablePatternList
+}
+
+// превращаем шаблон таблицы в регулярку для полного имени таблицы
+func compileTablePattern(pattern string) *regexp.Regexp {
+
+	pattern = strings.ToLower(pattern)
+
+	// шаблон с %s, например table_%s – подходит table_d1 / table__d2 и прочее
+	regexStr := regexp.QuoteMeta(pattern)
+	regexStr = strings.ReplaceAll(regexStr, "%s", `[a-z0-9_]+`)
+	regexStr = strings.ReplaceAll(regexStr, `\*`, `.*`)
+
+	return regexp.MustCompile(`^` + regexStr + `$`)
+}
+
+// получаем текущую политику записи
+func getWritePolicy() WritePolicyInterface {
+
+	return writePolicyStore.Load().(writePolicyHolderStruct).policy
+}
+
+// проверяем запрос на запись на резервном сервере
+// true – запрос выполнять нельзя, ошибка возвращается только в режиме ReserveWriteModeError
+func checkWriteOnReserve(dbKey string, query string) (bool, error) {
+
+	if !server.IsReserveServer() {
+		return false, nil
+	}
+
+	return checkWritePolicy(dbKey, query)
+}
+
+// проверяем произвольный запрос на резервном сервере, запросы на чтение не блокируются
+func checkQueryOnReserve(dbKey string, query string) (bool, error) {
+
+	if !server.IsReserveServer() || !isWriteRows(query) {
+		return false, nil
+	}
+
+	return checkWritePolicy(dbKey, query)
+}
+
+// проверяем запрос по политике записи
+func checkWritePolicy(dbKey string, query string) (bool, error) {
+
+	if getWritePolicy().IsAllowWrite(dbKey, query) {
+		return false, nil
+	}
+
+	if reserveWriteMode.Load() == ReserveWriteModeError {
+		return true, fmt.Errorf("%w: database %s, query: %s", ErrWriteBlockedOnReserve, dbKey, query)
+	}
+
+	return true, nil
+}
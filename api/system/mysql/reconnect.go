@@ -0,0 +1,135 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/getCompassUtils/go_base_frame/api/system/log"
+)
+
+// -------------------------------------------------------
+// пересоздание пулов соединений
+// пул, который несколько проверок подряд недоступен, и пул, у которого сменился пароль, открываются заново
+// внутри того же ConnectionPoolItem: вызывающие, сохранившие его, сразу работают через новый пул
+// -------------------------------------------------------
+
+const poolEvictFailCount = 3 // после скольких неудачных проверок подряд пул пересоздается
+
+// -------------------------------------------------------
+// PUBLIC
+// -------------------------------------------------------
+
+// RotateCredentials открываем сохраненный пул заново с новым пользователем и паролем
+// новый пул должен ответить на пинг, иначе остается старый и возвращается ошибка
+func RotateCredentials(ctx context.Context, db string, host string, user string, pass string) (*ConnectionPoolItem, error) {
+
+	uniqueKey := host + "-" + db
+	item, exist := mysqlConnectionPoolList.Load(uniqueKey)
+	if !exist {
+		return nil, fmt.Errorf("connection pool for db %s on host %s not found", db, host)
+	}
+	connectionItem := item.(*ConnectionPoolItem)
+
+	connectionItem.reopenMu.Lock()
+	defer connectionItem.reopenMu.Unlock()
+
+	config := connectionItem.config
+	config.User = user
+	config.Pass = pass
+
+	err := connectionItem.reopen(ctx, uniqueKey, config, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return connectionItem, nil
+}
+
+// GetConnectionPool получаем текущий пул соединений
+// поле ConnectionPool хранит пул на момент создания и после пересоздания устаревает
+func (connectionItem *ConnectionPoolItem) GetConnectionPool() *sql.DB {
+
+	if connectionPool := connectionItem.pool.Load(); connectionPool != nil {
+		return connectionPool
+	}
+
+	return connectionItem.ConnectionPool
+}
+
+// -------------------------------------------------------
+// PROTECTED
+// -------------------------------------------------------
+
+// пересоздаем пул, если он долго недоступен
+// хост при этом может быть еще недоступен: новый пул подменяет старый без проверки пингом,
+// чтобы избавиться от зависших соединений, и начинает работать, когда хост вернется
+func (connectionItem *ConnectionPoolItem) evictIfUnhealthy(ctx context.Context, key string) {
+
+	connectionItem.reopenMu.Lock()
+	defer connectionItem.reopenMu.Unlock()
+
+	// пул из ReplaceConnection пересоздать не из чего
+	if connectionItem.health.failCount.Load() < poolEvictFailCount || connectionItem.config.Host == "" {
+		return
+	}
+
+	err := connectionItem.reopen(ctx, key, connectionItem.config, false)
+	if err != nil {
+		log.Errorf("unable recreate connection pool %s, error: %v", key, err)
+	}
+}
+
+// открываем новый пул и подменяем им текущий, вызывается под reopenMu
+func (connectionItem *ConnectionPoolItem) reopen(ctx context.Context, key string, config ConnectionConfigStruct, isPingRequired bool) error {
+
+	newPool, err := connectToDb(config)
+	if err != nil {
+		return err
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+
+	err = newPool.PingContext(pingCtx)
+	if err != nil && isPingRequired {
+
+		_ = newPool.Close()
+		return fmt.Errorf("new connection pool %s is not reachable, error: %w", key, err)
+	}
+	if err != nil {
+		log.Warningf("connection pool %s recreated while host is unreachable, error: %v", key, err)
+	}
+
+	oldPool := connectionItem.GetConnectionPool()
+	connectionItem.pool.Store(newPool)
+	connectionItem.config = config
+	connectionItem.health.failCount.Store(0)
+
+	// подготовленные запросы принадлежат старому пулу
+	if cache := connectionItem.statementCache.Load(); cache != nil {
+		connectionItem.SetStatementCache(cache.capacity)
+	}
+
+	// Close ждет завершения уже начатых запросов, поэтому закрываем старый пул в фоне
+	go func() {
+
+		if err := oldPool.Close(); err != nil {
+			log.Warningf("unable close old connection pool %s, error: %v", key, err)
+		}
+	}()
+	log.Infof("connection pool %s recreated", key)
+
+	return nil
+}
+
+// получаем пул из хранилища по ключу, если его там нет – переданный
+func getStoredConnectionPool(key string, connectionItem *ConnectionPoolItem) *ConnectionPoolItem {
+
+	item, exist := mysqlConnectionPoolList.Load(key)
+	if !exist {
+		return connectionItem
+	}
+
+	return item.(*ConnectionPoolItem)
+}
@@ -0,0 +1,196 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/getCompassUtils/go_base_frame/api/system/functions"
+	"github.com/getCompassUtils/go_base_frame/api/system/log"
+)
+
+// -------------------------------------------------------
+// реестр пулов соединений
+// позволяет получить все сохраненные пулы со статистикой
+// и периодически пинговать их, отмечая недоступные
+// -------------------------------------------------------
+
+const defaultPoolCheckInterval = 10 * time.Second // как часто пингуем пулы по умолчанию
+
+// ConnectionPoolInfoStruct состояние сохраненного пула
+type ConnectionPoolInfoStruct struct {
+	Key         string      // ключ пула в хранилище
+	Host        string      // хост, пустой для пулов из ReplaceConnection
+	Db          string      // база данных
+	CreatedAt   int64       // время создания пула
+	IsHealthy   bool        // прошел ли пул последнюю проверку
+	FailCount   int64       // сколько проверок подряд завершились ошибкой
+	LastCheckAt int64       // время последней проверки, 0 – проверок не было
+	LastError   string      // ошибка последней проверки
+	Stats       sql.DBStats // статистика пула: открытые, занятые и простаивающие соединения, ожидания
+}
+
+// состояние пула по результатам проверок
+type poolHealthStruct struct {
+	failCount   atomic.Int64
+	lastCheckAt atomic.Int64
+	lastError   atomic.Pointer[string]
+}
+
+// фоновая проверка пулов
+type poolHealthCheckStruct struct {
+	mu       sync.Mutex
+	stopChan chan struct{}
+}
+
+var poolHealthCheck = poolHealthCheckStruct{}
+
+// -------------------------------------------------------
+// PUBLIC
+// -------------------------------------------------------
+
+// GetConnectionPoolList получаем все сохраненные пулы со статистикой, отсортированные по ключу
+func GetConnectionPoolList() []ConnectionPoolInfoStruct {
+
+	var infoList []ConnectionPoolInfoStruct
+	mysqlConnectionPoolList.Range(func(key, value any) bool {
+
+		infoList = append(infoList, value.(*ConnectionPoolItem).getInfo(key.(string)))
+		return true
+	})
+
+	sort.Slice(infoList, func(i, j int) bool {
+		return infoList[i].Key < infoList[j].Key
+	})
+
+	return infoList
+}
+
+// StartPoolHealthCheck запускаем фоновую проверку всех сохраненных пулов, 0 – интервал по умолчанию
+// повторный вызов перезапускает проверку с новым интервалом
+func StartPoolHealthCheck(interval time.Duration) {
+
+	if interval <= 0 {
+		interval = defaultPoolCheckInterval
+	}
+
+	poolHealthCheck.mu.Lock()
+	defer poolHealthCheck.mu.Unlock()
+
+	if poolHealthCheck.stopChan != nil {
+		close(poolHealthCheck.stopChan)
+	}
+
+	poolHealthCheck.stopChan = make(chan struct{})
+	go listenPoolHealthCheck(interval, poolHealthCheck.stopChan)
+}
+
+// StopPoolHealthCheck останавливаем фоновую проверку пулов
+func StopPoolHealthCheck() {
+
+	poolHealthCheck.mu.Lock()
+	defer poolHealthCheck.mu.Unlock()
+
+	if poolHealthCheck.stopChan == nil {
+		return
+	}
+
+	close(poolHealthCheck.stopChan)
+	poolHealthCheck.stopChan = nil
+}
+
+// CheckConnectionPoolList проверяем все сохраненные пулы сейчас, долго недоступные пулы пересоздаются
+func CheckConnectionPoolList(ctx context.Context) {
+
+	mysqlConnectionPoolList.Range(func(key, value any) bool {
+
+		connectionItem := value.(*ConnectionPoolItem)
+		connectionItem.checkHealth(ctx, key.(string))
+		connectionItem.evictIfUnhealthy(ctx, key.(string))
+		return true
+	})
+}
+
+// IsHealthy прошел ли пул последнюю проверку, непроверенный пул считается здоровым
+func (connectionItem *ConnectionPoolItem) IsHealthy() bool {
+
+	return connectionItem.health.failCount.Load() == 0
+}
+
+// Stats получаем статистику пула
+func (connectionItem *ConnectionPoolItem) Stats() sql.DBStats {
+
+	return connectionItem.GetConnectionPool().Stats()
+}
+
+// -------------------------------------------------------
+// PROTECTED
+// -------------------------------------------------------
+
+// периодически проверяем пулы, пока не закрыт канал
+func listenPoolHealthCheck(interval time.Duration, stopChan chan struct{}) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+
+		select {
+		case <-stopChan:
+			return
+		case <-ticker.C:
+			CheckConnectionPoolList(context.Background())
+		}
+	}
+}
+
+// пингуем пул и сохраняем результат
+func (connectionItem *ConnectionPoolItem) checkHealth(ctx context.Context, key string) {
+
+	pingCtx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+
+	err := connectionItem.GetConnectionPool().PingContext(pingCtx)
+	connectionItem.health.lastCheckAt.Store(functions.GetCurrentTimeStamp())
+
+	if err != nil {
+
+		errText := err.Error()
+		connectionItem.health.lastError.Store(&errText)
+
+		// логируем только смену состояния
+		if connectionItem.health.failCount.Add(1) == 1 {
+			log.Warningf("connection pool %s marked unhealthy, error: %v", key, err)
+		}
+		return
+	}
+
+	connectionItem.health.lastError.Store(nil)
+	if connectionItem.health.failCount.Swap(0) > 0 {
+		log.Infof("connection pool %s is healthy again", key)
+	}
+}
+
+// получаем состояние пула
+func (connectionItem *ConnectionPoolItem) getInfo(key string) ConnectionPoolInfoStruct {
+
+	info := ConnectionPoolInfoStruct{
+		Key:         key,
+		Host:        connectionItem.host,
+		Db:          connectionItem.dbKey,
+		CreatedAt:   connectionItem.createdAt,
+		IsHealthy:   connectionItem.IsHealthy(),
+		FailCount:   connectionItem.health.failCount.Load(),
+		LastCheckAt: connectionItem.health.lastCheckAt.Load(),
+		Stats:       connectionItem.Stats(),
+	}
+
+	if lastError := connectionItem.health.lastError.Load(); lastError != nil {
+		info.LastError = *lastError
+	}
+
+	return info
+}
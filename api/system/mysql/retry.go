@@ -0,0 +1,232 @@
+package mysql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/getCompassUtils/go_base_frame/api/system/log"
+	mysqldriver "github.com/go-sql-driver/mysql"
+)
+
+// -------------------------------------------------------
+// повтор запросов при временных ошибках mysql
+// повторяются только идемпотентные чтения и транзакции целиком
+// транзакция с ошибкой на COMMIT не повторяется – неизвестно, применилась ли она
+// -------------------------------------------------------
+
+// номера временных ошибок mysql, которые сервер присылает пакетом ошибки
+// клиентские 2006/2013 go-sql-driver в *MySQLError не отдает, потерю соединения
+// распознаем по ErrBadConn/ErrInvalidConn и тексту ошибки
+const (
+	errorNumberLockWaitTimeout = 1205 // превышено время ожидания блокировки
+	errorNumberDeadlock        = 1213 // взаимная блокировка
+)
+
+// RetryPolicyStruct политика повторов для пула
+type RetryPolicyStruct struct {
+	MaxAttempts int           // максимальное количество попыток, включая первую
+	BaseDelay   time.Duration // задержка перед второй попыткой, дальше растет вдвое
+	MaxDelay    time.Duration // максимальная задержка между попытками
+}
+
+// RetryError ошибка после исчерпания попыток
+type RetryError struct {
+	Attempts int   // сколько попыток было сделано
+	Err      error // ошибка последней попытки
+}
+
+// CommitError ошибка подтверждения транзакции, после нее неизвестно, применилась ли транзакция
+// поэтому IsRetryableError никогда не считает ее временной
+type CommitError struct {
+	Err error
+}
+
+// DefaultRetryPolicy политика по умолчанию для тех, кто включает повторы
+var DefaultRetryPolicy = RetryPolicyStruct{
+	MaxAttempts: 3,
+	BaseDelay:   50 * time.Millisecond,
+	MaxDelay:    time.Second,
+}
+
+// -------------------------------------------------------
+// PUBLIC
+// -------------------------------------------------------
+
+// Error текст ошибки
+func (retryError *RetryError) Error() string {
+
+	return fmt.Sprintf("failed after %d attempts: %v", retryError.Attempts, retryError.Err)
+}
+
+// Unwrap исходная ошибка
+func (retryError *RetryError) Unwrap() error {
+
+	return retryError.Err
+}
+
+// Error текст ошибки
+func (commitError *CommitError) Error() string {
+
+	return fmt.Sprintf("unable commit transaction, error: %v", commitError.Err)
+}
+
+// Unwrap исходная ошибка
+func (commitError *CommitError) Unwrap() error {
+
+	return commitError.Err
+}
+
+// IsRetryableError является ли ошибка временной, после которой запрос можно повторить
+func IsRetryableError(err error) bool {
+
+	var commitError *CommitError
+	if err == nil || errors.As(err, &commitError) {
+		return false
+	}
+
+	var mysqlError *mysqldriver.MySQLError
+	if errors.As(err, &mysqlError) {
+
+		switch mysqlError.Number {
+		case errorNumberLockWaitTimeout, errorNumberDeadlock:
+			return true
+		}
+		return false
+	}
+
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysqldriver.ErrInvalidConn) {
+		return true
+	}
+
+	// ошибки соединения от прокси между нами и mysql приходят только текстом
+	return strings.Contains(strings.ToLower(err.Error()), "server has gone away")
+}
+
+// SetRetryPolicy устанавливаем политику повторов для пула, MaxAttempts <= 1 отключает повторы
+func (connectionItem *ConnectionPoolItem) SetRetryPolicy(policy RetryPolicyStruct) {
+
+	connectionItem.retryPolicy.Store(&policy)
+}
+
+// RunWithRetry выполняем идемпотентную операцию с повторами по политике пула
+// возвращаем количество сделанных попыток
+func (connectionItem *ConnectionPoolItem) RunWithRetry(ctx context.Context, operation func(ctx context.Context) error) (int, error) {
+
+	return runWithRetry(ctx, connectionItem.getRetryPolicy(), operation)
+}
+
+// RetryTransaction выполняем функцию в транзакции, при временной ошибке повторяем транзакцию целиком
+// при ошибке функции транзакция откатывается, иначе подтверждается
+// ошибка подтверждения возвращается как *CommitError без повтора
+// возвращаем количество сделанных попыток
+func (connectionItem *ConnectionPoolItem) RetryTransaction(ctx context.Context, callback func(transactionItem *TransactionStruct) error) (int, error) {
+
+	return runWithRetry(ctx, connectionItem.getRetryPolicy(), func(ctx context.Context) error {
+		return connectionItem.RunInTransaction(ctx, nil, callback)
+	})
+}
+
+// -------------------------------------------------------
+// PROTECTED
+// -------------------------------------------------------
+
+// получаем политику повторов пула, по умолчанию – одна попытка
+func (connectionItem *ConnectionPoolItem) getRetryPolicy() RetryPolicyStruct {
+
+	policy := connectionItem.retryPolicy.Load()
+	if policy == nil {
+		return RetryPolicyStruct{MaxAttempts: 1}
+	}
+
+	return *policy
+}
+
+// выполняем запрос на чтение и форматируем ответ, при временной ошибке повторяем запрос
+func fetchWithRetry[R any](ctx context.Context, connectionItem *ConnectionPoolItem, format func(queryItem *queryStruct) R, empty R, query string, args ...interface{}) (R, error) {
+
+	response := empty
+	_, err := connectionItem.RunWithRetry(ctx, func(ctx context.Context) error {
+
+		queryContext, cancel := connectionItem.withQueryTimeout(ctx)
+		defer cancel()
+
+		// осуществляем запрос
+		queryItem, err := connectionItem.sendQueryForFormat(queryContext, query, args...)
+		if err != nil {
+
+			log.Errorf("unable send query, error: %v", err)
+			return err
+		}
+
+		response = format(queryItem)
+		return queryItem.err
+	})
+
+	return response, err
+}
+
+// выполняем операцию с повторами
+func runWithRetry(ctx context.Context, policy RetryPolicyStruct, operation func(ctx context.Context) error) (int, error) {
+
+	maxAttempts := policy.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	var err error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+
+		err = operation(ctx)
+		if err == nil {
+
+			if attempt > 1 {
+				log.Warningf("mysql operation succeeded after %d attempts", attempt)
+			}
+			return attempt, nil
+		}
+
+		// постоянные ошибки и последнюю попытку не повторяем
+		if !IsRetryableError(err) || attempt == maxAttempts {
+
+			if attempt > 1 {
+				return attempt, &RetryError{Attempts: attempt, Err: err}
+			}
+			return attempt, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return attempt, &RetryError{Attempts: attempt, Err: err}
+		case <-time.After(getRetryDelay(policy, attempt)):
+		}
+	}
+
+	return maxAttempts, err
+}
+
+// получаем задержку перед следующей попыткой: экспоненциальный рост со случайным разбросом
+func getRetryDelay(policy RetryPolicyStruct, attempt int) time.Duration {
+
+	if policy.BaseDelay <= 0 {
+		return 0
+	}
+
+	// сдвиг, который переполнил бы задержку, заменяем максимальной длительностью
+	delay := time.Duration(math.MaxInt64)
+	if shift := attempt - 1; shift < 63 && policy.BaseDelay <= delay>>shift {
+		delay = policy.BaseDelay << shift
+	}
+	if policy.MaxDelay > 0 && delay > policy.MaxDelay {
+		delay = policy.MaxDelay
+	}
+
+	// берем случайную задержку от половины до полной, чтобы повторы разных запросов не совпадали
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
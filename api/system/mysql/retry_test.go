@@ -0,0 +1,89 @@
+package mysql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+)
+
+// проверяем, какие ошибки считаются временными
+func TestIsRetryableError(t *testing.T) {
+
+	deadlock := &mysqldriver.MySQLError{Number: errorNumberDeadlock, Message: "Deadlock found"}
+
+	caseList := []struct {
+		name        string
+		err         error
+		isRetryable bool
+	}{
+		{"nil", nil, false},
+		{"deadlock", fmt.Errorf("query: x, error: %w", deadlock), true},
+		{"lock wait timeout", &mysqldriver.MySQLError{Number: errorNumberLockWaitTimeout}, true},
+		{"duplicate entry", &mysqldriver.MySQLError{Number: 1062}, false},
+		{"bad conn", driver.ErrBadConn, true},
+		{"invalid conn", mysqldriver.ErrInvalidConn, true},
+		{"gone away text", errors.New("MySQL server has gone away"), true},
+		{"commit deadlock", &CommitError{Err: deadlock}, false},
+		{"commit invalid conn", fmt.Errorf("wrap: %w", &CommitError{Err: mysqldriver.ErrInvalidConn}), false},
+	}
+
+	for _, c := range caseList {
+
+		t.Run(c.name, func(t *testing.T) {
+
+			if IsRetryableError(c.err) != c.isRetryable {
+				t.Fatalf("IsRetryableError(%v) = %v, want %v", c.err, !c.isRetryable, c.isRetryable)
+			}
+		})
+	}
+}
+
+// проверяем, что после ошибки подтверждения транзакция не повторяется
+func TestRunWithRetryCommitError(t *testing.T) {
+
+	attemptCount := 0
+	attempts, err := runWithRetry(context.Background(), RetryPolicyStruct{MaxAttempts: 3}, func(ctx context.Context) error {
+
+		attemptCount++
+		return &CommitError{Err: mysqldriver.ErrInvalidConn}
+	})
+
+	var commitError *CommitError
+	if attempts != 1 || attemptCount != 1 || !errors.As(err, &commitError) {
+		t.Fatalf("attempts = %d, calls = %d, err = %v, want 1 attempt with commit error", attempts, attemptCount, err)
+	}
+}
+
+// проверяем, что задержка не переполняется при большом числе попыток
+func TestGetRetryDelay(t *testing.T) {
+
+	caseList := []struct {
+		name     string
+		policy   RetryPolicyStruct
+		attempt  int
+		maxDelay time.Duration
+	}{
+		{"first attempt", RetryPolicyStruct{BaseDelay: 100 * time.Millisecond}, 1, 100 * time.Millisecond},
+		{"capped", RetryPolicyStruct{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}, 10, time.Second},
+		{"overflow without max delay", RetryPolicyStruct{BaseDelay: 100 * time.Millisecond}, 40, time.Duration(math.MaxInt64)},
+		{"shift above width without max delay", RetryPolicyStruct{BaseDelay: time.Millisecond}, 100, time.Duration(math.MaxInt64)},
+		{"overflow with max delay", RetryPolicyStruct{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}, 100, time.Second},
+	}
+
+	for _, c := range caseList {
+
+		t.Run(c.name, func(t *testing.T) {
+
+			delay := getRetryDelay(c.policy, c.attempt)
+			if delay < c.maxDelay/2 || delay > c.maxDelay {
+				t.Fatalf("getRetryDelay() = %v, want between %v and %v", delay, c.maxDelay/2, c.maxDelay)
+			}
+		})
+	}
+}
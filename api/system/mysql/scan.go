@@ -0,0 +1,443 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// -------------------------------------------------------
+// типизированное чтение строк ответа в структуры
+// поля структуры связываются с колонками через тег sqlname,
+// тот же, что использует FormatInsertOrUpdate
+// -------------------------------------------------------
+
+// имя тега, через который поле структуры связывается с колонкой
+const sqlTagName = "sqlname"
+
+// опция тега, помечающая колонку как json
+const sqlTagOptionJson = "json"
+
+// форматы, в которых mysql отдает дату и время без parseTime, с parseTime database/sql отдает RFC3339
+var timeFormatList = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	"15:04:05",
+}
+
+// тип, реализующий sql.Scanner
+var scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+
+// тип time.Time
+var timeType = reflect.TypeOf(time.Time{})
+
+// QueryExecutor объект, через который можно отправить запрос на чтение
+// реализуется ConnectionPoolItem и TransactionStruct
+type QueryExecutor interface {
+	sendQueryForFormat(ctx context.Context, query string, args ...interface{}) (*queryStruct, error)
+	withQueryTimeout(ctx context.Context) (context.Context, context.CancelFunc)
+}
+
+// разобранный тег sqlname
+type sqlTagStruct struct {
+	name       string
+	optionList map[string]bool
+}
+
+// поле структуры, в которое пишется колонка
+type scanFieldStruct struct {
+	index  []int
+	isJson bool
+}
+
+// кэш соответствия колонок полям для каждого типа структуры
+var scanFieldMapCache = sync.Map{}
+
+// -------------------------------------------------------
+// PUBLIC
+// -------------------------------------------------------
+
+// FetchOne получаем первую строку ответа в виде структуры
+// если строк нет – возвращаем sql.ErrNoRows
+func FetchOne[T any](ctx context.Context, executor QueryExecutor, query string, args ...interface{}) (T, error) {
+
+	var result T
+
+	queryContext, cancel := executor.withQueryTimeout(ctx)
+	defer cancel()
+
+	// осуществляем запрос
+	queryItem, err := executor.sendQueryForFormat(queryContext, query, args...)
+	if err != nil {
+		return result, err
+	}
+
+	// запрос был заблокирован на резервном сервере
+	if queryItem.rows == nil {
+		return result, sql.ErrNoRows
+	}
+
+	isFound, err := queryItem.scanFirst(&result)
+	if err != nil {
+		return result, fmt.Errorf("unable scan row, query: '%s', error: %w", query, err)
+	}
+
+	if !isFound {
+		return result, sql.ErrNoRows
+	}
+
+	return result, nil
+}
+
+// FetchAll получаем все строки ответа в виде списка структур
+func FetchAll[T any](ctx context.Context, executor QueryExecutor, query string, args ...interface{}) ([]T, error) {
+
+	queryContext, cancel := executor.withQueryTimeout(ctx)
+	defer cancel()
+
+	// осуществляем запрос
+	queryItem, err := executor.sendQueryForFormat(queryContext, query, args...)
+	if err != nil {
+		return []T{}, err
+	}
+
+	// запрос был заблокирован на резервном сервере
+	if queryItem.rows == nil {
+		return []T{}, nil
+	}
+
+	resultList := make([]T, 0)
+	err = queryItem.scanAll(func() interface{} {
+
+		resultList = append(resultList, *new(T))
+		return &resultList[len(resultList)-1]
+	})
+	if err != nil {
+		return []T{}, fmt.Errorf("unable scan rows, query: '%s', error: %w", query, err)
+	}
+
+	return resultList, nil
+}
+
+// -------------------------------------------------------
+// PROTECTED
+// -------------------------------------------------------
+
+// сканируем первую строку в структуру
+func (queryItem *queryStruct) scanFirst(dest interface{}) (bool, error) {
+
+	defer queryItem.afterFetchQuery()
+
+	if !queryItem.rows.Next() {
+		return false, queryItem.rows.Err()
+	}
+
+	// сканируем строку и обрабатываем ошибку
+	queryItem.handleError(queryItem.rows.Scan(queryItem.scanList...))
+	if queryItem.err != nil {
+		return false, queryItem.err
+	}
+
+	return true, queryItem.assignRow(dest)
+}
+
+// сканируем все строки, для каждой строки getDest возвращает структуру для заполнения
+func (queryItem *queryStruct) scanAll(getDest func() interface{}) error {
+
+	defer queryItem.afterFetchQuery()
+
+	for queryItem.rows.Next() {
+
+		// сканируем строку и обрабатываем ошибку
+		queryItem.handleError(queryItem.rows.Scan(queryItem.scanList...))
+		if queryItem.err != nil {
+			return queryItem.err
+		}
+
+		err := queryItem.assignRow(getDest())
+		if err != nil {
+			return err
+		}
+	}
+
+	queryItem.handleError(queryItem.rows.Err())
+	return queryItem.err
+}
+
+// раскладываем текущую отсканированную строку по полям структуры
+func (queryItem *queryStruct) assignRow(dest interface{}) error {
+
+	destValue := reflect.ValueOf(dest)
+	if destValue.Kind() != reflect.Ptr || destValue.IsNil() {
+		return fmt.Errorf("destination must be a non-nil pointer, got %T", dest)
+	}
+
+	destValue = destValue.Elem()
+	if destValue.Kind() != reflect.Struct {
+		return fmt.Errorf("destination must point to a struct, got %T", dest)
+	}
+
+	fieldMap := getScanFieldMap(destValue.Type())
+	for i, column := range queryItem.columnList {
+
+		// колонки без поля в структуре пропускаем
+		field, exist := fieldMap[column]
+		if !exist {
+			continue
+		}
+
+		err := assignColumnValue(destValue.FieldByIndex(field.index), queryItem.valueList[i], field.isJson, queryItem.location)
+		if err != nil {
+			return fmt.Errorf("column `%s`: %v", column, err)
+		}
+	}
+
+	return nil
+}
+
+// получаем соответствие колонок полям структуры
+func getScanFieldMap(structType reflect.Type) map[string]scanFieldStruct {
+
+	if cached, exist := scanFieldMapCache.Load(structType); exist {
+		return cached.(map[string]scanFieldStruct)
+	}
+
+	fieldMap := make(map[string]scanFieldStruct)
+	collectScanFieldList(structType, nil, fieldMap)
+
+	scanFieldMapCache.Store(structType, fieldMap)
+	return fieldMap
+}
+
+// собираем поля структуры, включая встроенные структуры без тега
+func collectScanFieldList(structType reflect.Type, parentIndex []int, fieldMap map[string]scanFieldStruct) {
+
+	for i := 0; i < structType.NumField(); i++ {
+
+		field := structType.Field(i)
+		index := append(append([]int{}, parentIndex...), i)
+
+		tag, ok := parseSqlTag(field)
+
+		// встроенную структуру без тега разбираем рекурсивно
+		if !ok && field.Anonymous && field.Type.Kind() == reflect.Struct {
+
+			collectScanFieldList(field.Type, index, fieldMap)
+			continue
+		}
+
+		if !ok || !field.IsExported() {
+			continue
+		}
+
+		fieldMap[tag.name] = scanFieldStruct{
+			index:  index,
+			isJson: tag.optionList[sqlTagOptionJson],
+		}
+	}
+}
+
+// разбираем тег sqlname поля, вида sqlname:"column,option,option"
+func parseSqlTag(field reflect.StructField) (sqlTagStruct, bool) {
+
+	tag, ok := field.Tag.Lookup(sqlTagName)
+
+	// если не нашли или поле явно исключено - пропускаем
+	if !ok || tag == "-" {
+		return sqlTagStruct{}, false
+	}
+
+	partList := strings.Split(tag, ",")
+	sqlTag := sqlTagStruct{
+		name:       strings.TrimSpace(partList[0]),
+		optionList: make(map[string]bool),
+	}
+
+	for _, option := range partList[1:] {
+		sqlTag.optionList[strings.TrimSpace(option)] = true
+	}
+
+	if sqlTag.name == "" {
+		return sqlTagStruct{}, false
+	}
+
+	return sqlTag, true
+}
+
+// получаем значение поля для записи в базу, json колонки сериализуем
+func getSqlFieldValue(field reflect.Value, tag sqlTagStruct) (interface{}, error) {
+
+	if !tag.optionList[sqlTagOptionJson] {
+		return field.Interface(), nil
+	}
+
+	encoded, err := json.Marshal(field.Interface())
+	if err != nil {
+		return nil, fmt.Errorf("unable encode json column `%s`, error: %v", tag.name, err)
+	}
+
+	return string(encoded), nil
+}
+
+// записываем значение колонки в поле
+// дата без часового пояса разбирается в location – часовом поясе соединения, как это делает драйвер с parseTime
+func assignColumnValue(dest reflect.Value, raw sql.RawBytes, isJson bool, location *time.Location) error {
+
+	// тип сам умеет сканировать значения, например sql.NullString
+	if dest.CanAddr() && dest.Addr().Type().Implements(scannerType) {
+
+		var value interface{}
+		if raw != nil {
+			value = append([]byte{}, raw...)
+		}
+		return dest.Addr().Interface().(sql.Scanner).Scan(value)
+	}
+
+	// NULL записываем как нулевое значение, для указателя – nil
+	if raw == nil {
+
+		dest.Set(reflect.Zero(dest.Type()))
+		return nil
+	}
+
+	// для указателя создаем значение и заполняем его
+	if dest.Kind() == reflect.Ptr {
+
+		value := reflect.New(dest.Type().Elem())
+		err := assignColumnValue(value.Elem(), raw, isJson, location)
+		if err != nil {
+			return err
+		}
+
+		dest.Set(value)
+		return nil
+	}
+
+	if dest.Type() == timeType {
+		return assignTimeValue(dest, string(raw), location)
+	}
+
+	// вложенный json
+	if isJson {
+
+		if len(raw) == 0 {
+			dest.Set(reflect.Zero(dest.Type()))
+			return nil
+		}
+		return json.Unmarshal(raw, dest.Addr().Interface())
+	}
+
+	switch dest.Kind() {
+	case reflect.String:
+
+		dest.SetString(string(raw))
+		return nil
+	case reflect.Slice:
+
+		if dest.Type().Elem().Kind() != reflect.Uint8 {
+			break
+		}
+
+		dest.SetBytes(append([]byte{}, raw...))
+		return nil
+	case reflect.Bool:
+
+		value, err := parseBoolValue(raw)
+		if err != nil {
+			return err
+		}
+
+		dest.SetBool(value)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+
+		value, err := strconv.ParseInt(string(raw), 10, dest.Type().Bits())
+		if err != nil {
+			return err
+		}
+
+		dest.SetInt(value)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+
+		value, err := strconv.ParseUint(string(raw), 10, dest.Type().Bits())
+		if err != nil {
+			return err
+		}
+
+		dest.SetUint(value)
+		return nil
+	case reflect.Float32, reflect.Float64:
+
+		value, err := strconv.ParseFloat(string(raw), dest.Type().Bits())
+		if err != nil {
+			return err
+		}
+
+		dest.SetFloat(value)
+		return nil
+	case reflect.Struct, reflect.Map:
+
+		if len(raw) == 0 {
+			return nil
+		}
+		return json.Unmarshal(raw, dest.Addr().Interface())
+	}
+
+	return fmt.Errorf("unsupported destination type %s", dest.Type())
+}
+
+// разбираем логическое значение: любое ненулевое число TINYINT – true, BIT(1) приходит байтом 0 или 1
+func parseBoolValue(raw sql.RawBytes) (bool, error) {
+
+	if len(raw) == 1 && raw[0] <= 1 {
+		return raw[0] == 1, nil
+	}
+
+	if value, err := strconv.ParseInt(string(raw), 10, 64); err == nil {
+		return value != 0, nil
+	}
+
+	return strconv.ParseBool(string(raw))
+}
+
+// записываем дату и время
+func assignTimeValue(dest reflect.Value, raw string, location *time.Location) error {
+
+	// нулевая дата mysql
+	if raw == "" || strings.HasPrefix(raw, "0000-00-00") {
+
+		dest.Set(reflect.ValueOf(time.Time{}))
+		return nil
+	}
+
+	for _, format := range timeFormatList {
+
+		value, err := time.ParseInLocation(format, raw, location)
+		if err == nil {
+
+			dest.Set(reflect.ValueOf(value))
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unable parse time value '%s'", raw)
+}
+
+// получаем часовой пояс пула, по умолчанию UTC, как у драйвера
+func (connectionItem *ConnectionPoolItem) getLocation() *time.Location {
+
+	if connectionItem == nil || connectionItem.location == nil {
+		return time.UTC
+	}
+
+	return connectionItem.location
+}
@@ -0,0 +1,71 @@
+package mysql
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// проверяем разбор логических значений
+func TestParseBoolValue(t *testing.T) {
+
+	caseList := []struct {
+		name  string
+		raw   sql.RawBytes
+		value bool
+	}{
+		{"tinyint 0", sql.RawBytes("0"), false},
+		{"tinyint 1", sql.RawBytes("1"), true},
+		{"tinyint 2", sql.RawBytes("2"), true},
+		{"tinyint -1", sql.RawBytes("-1"), true},
+		{"bit 0", sql.RawBytes{0}, false},
+		{"bit 1", sql.RawBytes{1}, true},
+		{"text true", sql.RawBytes("true"), true},
+	}
+
+	for _, c := range caseList {
+
+		t.Run(c.name, func(t *testing.T) {
+
+			value, err := parseBoolValue(c.raw)
+			if err != nil || value != c.value {
+				t.Fatalf("parseBoolValue(%q) = %v, %v, want %v", c.raw, value, err, c.value)
+			}
+		})
+	}
+
+	if _, err := parseBoolValue(sql.RawBytes("yes")); err == nil {
+		t.Fatalf("expected error for 'yes'")
+	}
+}
+
+// проверяем, что дата без часового пояса разбирается в часовом поясе соединения
+func TestAssignTimeValue(t *testing.T) {
+
+	location := time.FixedZone("UTC+3", 3*60*60)
+	caseList := []struct {
+		name     string
+		raw      string
+		location *time.Location
+		value    time.Time
+	}{
+		{"utc", "2024-05-01 10:00:00", time.UTC, time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)},
+		{"connection location", "2024-05-01 10:00:00", location, time.Date(2024, 5, 1, 7, 0, 0, 0, time.UTC)},
+		{"microseconds", "2024-05-01 10:00:00.123456", location, time.Date(2024, 5, 1, 7, 0, 0, 123456000, time.UTC)},
+		{"parse time", "2024-05-01T10:00:00+03:00", time.UTC, time.Date(2024, 5, 1, 7, 0, 0, 0, time.UTC)},
+		{"zero date", "0000-00-00 00:00:00", location, time.Time{}},
+	}
+
+	for _, c := range caseList {
+
+		t.Run(c.name, func(t *testing.T) {
+
+			var value time.Time
+			err := assignTimeValue(reflect.ValueOf(&value).Elem(), c.raw, c.location)
+			if err != nil || !value.Equal(c.value) {
+				t.Fatalf("assignTimeValue(%q) = %v, %v, want %v", c.raw, value, err, c.value)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package mysql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// -------------------------------------------------------
+// маршрутизация по шардам
+// ключ шарда (id компании, id пользователя, время) по правилу превращается
+// в хост, базу и таблицу, например company_123 на mysql-2 и message_2024_5
+// -------------------------------------------------------
+
+const (
+	ShardStrategyKey    = 0 // суффикс – сам ключ, например база на каждую компанию
+	ShardStrategyModulo = 1 // суффикс – остаток от деления ключа на Divisor
+	ShardStrategyRange  = 2 // суффикс – номер диапазона размером Divisor, начиная с 1
+	ShardStrategyTime   = 3 // ключ – unix время, суффикс – время в формате TimeFormat
+)
+
+// ErrIncorrectShardKey ключ не подходит для правила: отрицательный или нулевой для диапазонов
+var ErrIncorrectShardKey = errors.New("incorrect shard key")
+
+// ShardLevelStruct правило получения имени на одном уровне: хост, база или таблица
+type ShardLevelStruct struct {
+	Pattern    string // шаблон имени, %s заменяется суффиксом шарда, без %s имя не зависит от ключа
+	Strategy   int    // как получить суффикс из ключа
+	Divisor    int64  // делитель для ShardStrategyModulo и размер диапазона для ShardStrategyRange
+	TimeFormat string // формат времени для ShardStrategyTime, например 2006_1
+}
+
+// ShardRuleStruct правило шардирования
+type ShardRuleStruct struct {
+	Host             ShardLevelStruct       // хост с портом
+	Db               ShardLevelStruct       // база данных
+	Table            ShardLevelStruct       // таблица, пустой шаблон – таблица не шардируется
+	ConnectionConfig ConnectionConfigStruct // параметры подключения, Host и Db заменяются вычисленными
+}
+
+// ShardStruct вычисленный шард
+type ShardStruct struct {
+	Host  string
+	Db    string
+	Table string
+}
+
+// ShardRouterStruct маршрутизатор по шардам
+type ShardRouterStruct struct {
+	mu       sync.RWMutex
+	ruleList map[string]ShardRuleStruct
+}
+
+// -------------------------------------------------------
+// PUBLIC
+// -------------------------------------------------------
+
+// NewShardRouter создаем маршрутизатор без правил
+func NewShardRouter() *ShardRouterStruct {
+
+	return &ShardRouterStruct{ruleList: make(map[string]ShardRuleStruct)}
+}
+
+// AddRule добавляем или заменяем правило с именем name, например company или message
+func (router *ShardRouterStruct) AddRule(name string, rule ShardRuleStruct) error {
+
+	for levelName, level := range map[string]ShardLevelStruct{"host": rule.Host, "db": rule.Db, "table": rule.Table} {
+
+		err := level.validate()
+		if err != nil {
+			return fmt.Errorf("shard rule %s, %s level: %w", name, levelName, err)
+		}
+	}
+
+	if rule.Host.Pattern == "" || rule.Db.Pattern == "" {
+		return fmt.Errorf("shard rule %s must have host and db patterns", name)
+	}
+
+	router.mu.Lock()
+	defer router.mu.Unlock()
+
+	router.ruleList[name] = rule
+	return nil
+}
+
+// Resolve получаем хост, базу и таблицу для ключа по правилу
+func (router *ShardRouterStruct) Resolve(name string, key int64) (ShardStruct, error) {
+
+	router.mu.RLock()
+	rule, exist := router.ruleList[name]
+	router.mu.RUnlock()
+
+	if !exist {
+		return ShardStruct{}, fmt.Errorf("shard rule %s not found", name)
+	}
+
+	// отрицательный ключ дал бы отрицательный суффикс или время до 1970 года
+	if key < 0 {
+		return ShardStruct{}, fmt.Errorf("%w: shard rule %s, key %d is negative", ErrIncorrectShardKey, name, key)
+	}
+
+	for levelName, level := range map[string]ShardLevelStruct{"host": rule.Host, "db": rule.Db, "table": rule.Table} {
+
+		// диапазоны нумеруются с 1, нулевой ключ попал бы в несуществующий диапазон 0
+		if level.Strategy == ShardStrategyRange && key == 0 && strings.Contains(level.Pattern, "%s") {
+			return ShardStruct{}, fmt.Errorf("%w: shard rule %s, %s level: key must be positive for range", ErrIncorrectShardKey, name, levelName)
+		}
+	}
+
+	return ShardStruct{
+		Host:  rule.Host.format(key),
+		Db:    rule.Db.format(key),
+		Table: rule.Table.format(key),
+	}, nil
+}
+
+// GetConnection получаем пул шарда и имя таблицы для ключа по правилу
+func (router *ShardRouterStruct) GetConnection(ctx context.Context, name string, key int64) (*ConnectionPoolItem, string, error) {
+
+	shard, err := router.Resolve(name, key)
+	if err != nil {
+		return nil, "", err
+	}
+
+	router.mu.RLock()
+	config := router.ruleList[name].ConnectionConfig
+	router.mu.RUnlock()
+
+	config.Host = shard.Host
+	config.Db = shard.Db
+
+	connectionItem, err := GetMysqlConnectionWithConfig(ctx, config)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return connectionItem, shard.Table, nil
+}
+
+// -------------------------------------------------------
+// PROTECTED
+// -------------------------------------------------------
+
+// проверяем правило уровня
+func (level ShardLevelStruct) validate() error {
+
+	switch level.Strategy {
+	case ShardStrategyKey:
+	case ShardStrategyModulo, ShardStrategyRange:
+
+		if level.Divisor <= 0 {
+			return fmt.Errorf("divisor must be positive")
+		}
+	case ShardStrategyTime:
+
+		if level.TimeFormat == "" {
+			return fmt.Errorf("time format is required")
+		}
+	default:
+		return fmt.Errorf("unknown strategy %d", level.Strategy)
+	}
+
+	return nil
+}
+
+// получаем имя на уровне для ключа
+func (level ShardLevelStruct) format(key int64) string {
+
+	if !strings.Contains(level.Pattern, "%s") {
+		return level.Pattern
+	}
+
+	return strings.ReplaceAll(level.Pattern, "%s", level.getSuffix(key))
+}
+
+// получаем суффикс шарда для ключа
+func (level ShardLevelStruct) getSuffix(key int64) string {
+
+	switch level.Strategy {
+	case ShardStrategyModulo:
+
+		// остаток от деления отрицательного числа в go отрицательный, берем неотрицательный
+		return strconv.FormatInt((key%level.Divisor+level.Divisor)%level.Divisor, 10)
+	case ShardStrategyRange:
+		return strconv.FormatInt((key-1)/level.Divisor+1, 10)
+	case ShardStrategyTime:
+		return time.Unix(key, 0).UTC().Format(level.TimeFormat)
+	default:
+		return strconv.FormatInt(key, 10)
+	}
+}
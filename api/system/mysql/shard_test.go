@@ -0,0 +1,36 @@
+package mysql
+
+import (
+	"errors"
+	"testing"
+)
+
+// проверяем шард для ключа и отказ для некорректных ключей
+func TestShardRouterResolve(t *testing.T) {
+
+	router := NewShardRouter()
+	err := router.AddRule("company", ShardRuleStruct{
+		Host:  ShardLevelStruct{Pattern: "mysql-%s", Strategy: ShardStrategyModulo, Divisor: 3},
+		Db:    ShardLevelStruct{Pattern: "company_%s", Strategy: ShardStrategyRange, Divisor: 1000},
+		Table: ShardLevelStruct{Pattern: "message"},
+	})
+	if err != nil {
+		t.Fatalf("unable add rule: %v", err)
+	}
+
+	shard, err := router.Resolve("company", 1001)
+	if err != nil || shard != (ShardStruct{Host: "mysql-2", Db: "company_2", Table: "message"}) {
+		t.Fatalf("shard = %+v, err = %v", shard, err)
+	}
+
+	for _, key := range []int64{-1, 0} {
+
+		if _, err = router.Resolve("company", key); !errors.Is(err, ErrIncorrectShardKey) {
+			t.Fatalf("key %d: err = %v, want ErrIncorrectShardKey", key, err)
+		}
+	}
+
+	if suffix := (ShardLevelStruct{Strategy: ShardStrategyModulo, Divisor: 3}).getSuffix(-1); suffix != "2" {
+		t.Fatalf("suffix = %q, want non-negative modulo", suffix)
+	}
+}
@@ -0,0 +1,201 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/getCompassUtils/go_base_frame/api/system/log"
+	"github.com/getCompassUtils/go_base_frame/api/system/server"
+)
+
+// -------------------------------------------------------
+// лог медленных запросов
+// запрос пула или транзакции дольше порога пишется в лог с отпечатком запроса и местом вызова,
+// на тестовых серверах к медленному SELECT можно приложить вывод EXPLAIN
+// -------------------------------------------------------
+
+// сколько кадров стека просматриваем в поисках места вызова
+const slowQueryCallerDepth = 32
+
+// SlowQueryConfigStruct настройки лога медленных запросов
+type SlowQueryConfigStruct struct {
+	Threshold time.Duration // запросы дольше порога пишутся в лог, 0 – лог выключен
+	IsExplain bool          // прикладывать ли EXPLAIN к медленным SELECT, работает только на тестовых серверах
+}
+
+// хук, пишущий медленные запросы в лог
+type slowQueryHookStruct struct {
+	connectionItem *ConnectionPoolItem
+	config         atomic.Pointer[SlowQueryConfigStruct]
+}
+
+// путь пакета, чтобы пропускать его кадры при поиске места вызова
+var packagePath = reflect.TypeOf(slowQueryHookStruct{}).PkgPath()
+
+// -------------------------------------------------------
+// PUBLIC
+// -------------------------------------------------------
+
+// SetSlowQueryLog включаем лог медленных запросов для пула и его транзакций
+func (connectionItem *ConnectionPoolItem) SetSlowQueryLog(config SlowQueryConfigStruct) {
+
+	hook := &slowQueryHookStruct{connectionItem: connectionItem}
+	hook.config.Store(&config)
+
+	// хук регистрируем один раз, дальше только меняем настройки
+	if !connectionItem.slowQueryHook.CompareAndSwap(nil, hook) {
+
+		connectionItem.slowQueryHook.Load().config.Store(&config)
+		return
+	}
+
+	connectionItem.AddQueryHook(hook)
+}
+
+// BeforeQuery ничего не делаем до запроса
+func (hook *slowQueryHookStruct) BeforeQuery(ctx context.Context, _ *QueryEventStruct) context.Context {
+
+	return ctx
+}
+
+// AfterQuery пишем запрос в лог, если он дольше порога
+func (hook *slowQueryHookStruct) AfterQuery(_ context.Context, event *QueryEventStruct) {
+
+	config := hook.config.Load()
+	if config.Threshold <= 0 || event.Duration < config.Threshold {
+		return
+	}
+
+	caller := getQueryCaller()
+	fingerprint := getQueryFingerprint(event.Query)
+
+	// EXPLAIN выполняем отдельно, чтобы не задерживать вызывающего
+	if config.IsExplain && server.IsTest() && isSelectQuery(event.Query) {
+
+		go hook.logWithExplain(event.Query, event.argList, fingerprint, event.Duration, caller)
+		return
+	}
+
+	log.Warningf("slow query on %s, duration: %s, caller: %s, fingerprint: %s", event.DbKey, event.Duration, caller, fingerprint)
+}
+
+// -------------------------------------------------------
+// PROTECTED
+// -------------------------------------------------------
+
+// пишем в лог медленный запрос вместе с EXPLAIN
+func (hook *slowQueryHookStruct) logWithExplain(query string, argList []interface{}, fingerprint string, duration time.Duration, caller string) {
+
+	ctx, cancel := hook.connectionItem.withQueryTimeout(context.Background())
+	defer cancel()
+
+	explain, err := getExplain(ctx, hook.connectionItem.GetConnectionPool(), query, argList)
+	if err != nil {
+		explain = fmt.Sprintf("unable get explain, error: %v", err)
+	}
+
+	log.Warningf("slow query on %s, duration: %s, caller: %s, fingerprint: %s\nexplain:\n%s",
+		hook.connectionItem.dbKey, duration, caller, fingerprint, explain)
+}
+
+// получаем вывод EXPLAIN, запрос идет мимо хуков, чтобы не попасть в лог повторно
+func getExplain(ctx context.Context, connectionPool *sql.DB, query string, argList []interface{}) (string, error) {
+
+	rows, err := connectionPool.QueryContext(ctx, "EXPLAIN "+query, argList...)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	columnList, err := rows.Columns()
+	if err != nil {
+		return "", err
+	}
+
+	valueList := make([]sql.RawBytes, len(columnList))
+	scanList := make([]interface{}, len(valueList))
+	for i := range valueList {
+		scanList[i] = &valueList[i]
+	}
+
+	var explain strings.Builder
+	for rows.Next() {
+
+		err = rows.Scan(scanList...)
+		if err != nil {
+			return "", err
+		}
+
+		for i, value := range valueList {
+			explain.WriteString(fmt.Sprintf("%s=%s ", columnList[i], string(value)))
+		}
+		explain.WriteString("\n")
+	}
+
+	return explain.String(), rows.Err()
+}
+
+// является ли запрос запросом на чтение
+func isSelectQuery(query string) bool {
+
+	return parseStatement(query).verb == "SELECT"
+}
+
+// получаем отпечаток запроса: без комментариев и значений, списки в IN свернуты
+func getQueryFingerprint(query string) string {
+
+	var partList []string
+	for _, token := range tokenizeSql(query) {
+
+		switch {
+		case token.kind == tokenString:
+			partList = append(partList, "?")
+		case token.kind == tokenIdentifier:
+			partList = append(partList, "`"+strings.ToLower(token.value)+"`")
+		case token.kind == tokenWord && token.value[0] >= '0' && token.value[0] <= '9':
+			partList = append(partList, "?")
+		case token.kind == tokenWord:
+			partList = append(partList, strings.ToLower(token.value))
+		default:
+			partList = append(partList, token.value)
+		}
+	}
+
+	fingerprint := strings.Join(partList, " ")
+
+	// сворачиваем списки значений, чтобы IN (1, 2) и IN (1, 2, 3) давали один отпечаток
+	for strings.Contains(fingerprint, "? , ?") {
+		fingerprint = strings.ReplaceAll(fingerprint, "? , ?", "?")
+	}
+	fingerprint = strings.ReplaceAll(fingerprint, "in ( ? )", "in (?+)")
+
+	return fingerprint
+}
+
+// получаем место вызова запроса за пределами пакета
+func getQueryCaller() string {
+
+	pcList := make([]uintptr, slowQueryCallerDepth)
+	count := runtime.Callers(2, pcList)
+	frameList := runtime.CallersFrames(pcList[:count])
+
+	for {
+
+		frame, isMore := frameList.Next()
+		if !strings.HasPrefix(frame.Function, packagePath+".") && !strings.HasPrefix(frame.Function, "database/sql") {
+			return fmt.Sprintf("%s:%d", frame.File, frame.Line)
+		}
+
+		if !isMore {
+			return "unknown"
+		}
+	}
+}
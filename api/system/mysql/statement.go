@@ -0,0 +1,709 @@
+package mysql
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/getCompassUtils/go_base_frame/api/system/functions"
+)
+
+// -------------------------------------------------------
+// легкий разбор sql запроса
+// убирает комментарии, определяет глагол запроса и таблицы, которые он меняет
+// используется проверками записи на резервном сервере
+// -------------------------------------------------------
+
+// виды токенов
+const (
+	tokenWord       = 1 // ключевое слово, имя или число
+	tokenIdentifier = 2 // имя в обратных кавычках
+	tokenString     = 3 // строка в кавычках
+	tokenSymbol     = 4 // одиночный символ
+)
+
+// глаголы запросов, меняющих базу
+var writeVerbMap = map[string]bool{
+	"INSERT":   true,
+	"UPDATE":   true,
+	"DELETE":   true,
+	"REPLACE":  true,
+	"CREATE":   true,
+	"DROP":     true,
+	"ALTER":    true,
+	"TRUNCATE": true,
+	"LOCK":     true,
+	"UNLOCK":   true,
+	"RENAME":   true,
+	"GRANT":    true,
+	"REVOKE":   true,
+	"LOAD":     true,
+	"CALL":     true, // процедура может менять данные, изменяемые таблицы из запроса не определить
+	"DO":       true, // DO вызывает функции, которые тоже могут менять данные
+}
+
+// слова, которые не могут быть алиасом таблицы
+var notAliasWordMap = map[string]bool{
+	"SET": true, "WHERE": true, "JOIN": true, "LEFT": true, "RIGHT": true, "INNER": true, "OUTER": true,
+	"CROSS": true, "NATURAL": true, "STRAIGHT_JOIN": true, "ON": true, "USING": true, "ORDER": true,
+	"LIMIT": true, "FROM": true, "PARTITION": true, "READ": true, "WRITE": true, "LOW_PRIORITY": true,
+	"VALUES": true, "VALUE": true, "SELECT": true, "FORCE": true, "IGNORE": true, "USE": true,
+	"GROUP": true, "HAVING": true, "FOR": true, "UNION": true, "WINDOW": true, "LOCK": true, "AS": true,
+}
+
+// слова, после которых в списке таблиц начинается следующая таблица
+var joinWordMap = map[string]bool{
+	"JOIN":          true,
+	"STRAIGHT_JOIN": true,
+}
+
+// таблицы привилегий, которые меняют запросы управления пользователями
+var privilegeTableList = []string{"mysql.user", "mysql.db", "mysql.tables_priv"}
+
+// токен запроса
+type sqlTokenStruct struct {
+	kind  int
+	value string
+}
+
+// разобранный запрос
+type statementStruct struct {
+	verb      string   // глагол запроса в верхнем регистре
+	tableList []string // изменяемые таблицы в нижнем регистре, вида table или db.table
+}
+
+// разбор списка токенов
+type statementParserStruct struct {
+	tokenList   []sqlTokenStruct
+	position    int
+	cteNameList map[string]bool
+}
+
+// -------------------------------------------------------
+// PROTECTED
+// -------------------------------------------------------
+
+// проверяет является ли запрос query изменяющим таблицу
+func isWriteRows(query string) bool {
+
+	return writeVerbMap[parseStatement(query).verb]
+}
+
+// проверяем является ли запрос блокирующим чтением: FOR UPDATE, FOR SHARE или LOCK IN SHARE MODE
+func isLockingRead(query string) bool {
+
+	tokenList := tokenizeSql(query)
+	for i := 0; i+1 < len(tokenList); i++ {
+
+		if tokenList[i].kind != tokenWord || tokenList[i+1].kind != tokenWord {
+			continue
+		}
+
+		word, next := strings.ToUpper(tokenList[i].value), strings.ToUpper(tokenList[i+1].value)
+		if (word == "FOR" && (next == "UPDATE" || next == "SHARE")) || (word == "LOCK" && next == "IN") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// получаем таблицы, из которых читает запрос, включая подзапросы и join
+func getReadTableList(query string) []string {
+
+	parser := &statementParserStruct{tokenList: tokenizeSql(query), cteNameList: make(map[string]bool)}
+
+	var tableList []string
+	for parser.position < len(parser.tokenList) {
+
+		if !parser.isWord("FROM") && !(parser.isKind(tokenWord) && joinWordMap[parser.upper()]) {
+
+			parser.position++
+			continue
+		}
+		parser.position++
+
+		// FROM a, b – читаем список через запятую
+		for {
+
+			name, isRead := parser.readName()
+			if !isRead {
+				break
+			}
+			tableList = append(tableList, name)
+
+			parser.readAlias()
+			if !parser.isSymbol(",") {
+				break
+			}
+			parser.position++
+		}
+	}
+
+	return tableList
+}
+
+// разбираем запрос
+func parseStatement(query string) statementStruct {
+
+	parser := &statementParserStruct{tokenList: tokenizeSql(query), cteNameList: make(map[string]bool)}
+
+	// запрос может быть обернут в скобки, например (SELECT ...) UNION (SELECT ...)
+	for parser.isSymbol("(") {
+		parser.position++
+	}
+
+	if parser.isWord("WITH") {
+
+		parser.position++
+		parser.skipCommonTableExpressionList()
+	}
+
+	if !parser.isKind(tokenWord) {
+		return statementStruct{}
+	}
+
+	statement := statementStruct{verb: parser.upper()}
+	parser.position++
+
+	switch statement.verb {
+	case "INSERT", "REPLACE":
+		statement.tableList = parser.parseInsertTableList()
+	case "UPDATE":
+		statement.tableList = parser.parseUpdateTableList()
+	case "DELETE":
+		statement.tableList = parser.parseDeleteTableList()
+	case "TRUNCATE":
+
+		parser.skipWordList("TABLE")
+		statement.tableList = parser.readNameList(false)
+	case "CREATE", "DROP", "ALTER":
+		statement.tableList = parser.parseSchemaTableList()
+	case "LOCK":
+
+		parser.skipWordList("TABLES", "TABLE")
+		statement.tableList = parser.readNameList(true)
+	case "RENAME":
+		statement.tableList = parser.parseRenameTableList()
+	case "GRANT", "REVOKE":
+		statement.tableList = privilegeTableList
+	case "LOAD":
+
+		if parser.skipUntilWord("INTO") {
+
+			parser.skipWordList("TABLE")
+			statement.tableList = parser.readNameList(false)
+		}
+	}
+
+	statement.tableList = parser.excludeCteNameList(statement.tableList)
+	return statement
+}
+
+// разбиваем запрос на токены, пропуская пробелы и комментарии
+func tokenizeSql(query string) []sqlTokenStruct {
+
+	var tokenList []sqlTokenStruct
+	runeList := []rune(query)
+	isInsideVersionComment := false
+
+	for i := 0; i < len(runeList); {
+
+		current := runeList[i]
+		next := rune(0)
+		if i+1 < len(runeList) {
+			next = runeList[i+1]
+		}
+
+		switch {
+		case unicode.IsSpace(current):
+			i++
+
+		// комментарий до конца строки: # или "-- "
+		case current == '#' || (current == '-' && next == '-' && (i+2 >= len(runeList) || unicode.IsSpace(runeList[i+2]))):
+			for i < len(runeList) && runeList[i] != '\n' {
+				i++
+			}
+
+		// исполняемый комментарий /*!50100 ... */ – его содержимое является частью запроса
+		case current == '/' && next == '*' && i+2 < len(runeList) && runeList[i+2] == '!':
+
+			i += 3
+			for i < len(runeList) && unicode.IsDigit(runeList[i]) {
+				i++
+			}
+			isInsideVersionComment = true
+
+		case current == '*' && next == '/' && isInsideVersionComment:
+
+			i += 2
+			isInsideVersionComment = false
+
+		// обычный комментарий и подсказки оптимизатору
+		case current == '/' && next == '*':
+
+			i += 2
+			for i < len(runeList) && !(runeList[i] == '*' && i+1 < len(runeList) && runeList[i+1] == '/') {
+				i++
+			}
+			i += 2
+
+		case current == '\'' || current == '"':
+
+			value, end := readQuoted(runeList, i, true)
+			tokenList = append(tokenList, sqlTokenStruct{kind: tokenString, value: value})
+			i = end
+
+		case current == '`':
+
+			value, end := readQuoted(runeList, i, false)
+			tokenList = append(tokenList, sqlTokenStruct{kind: tokenIdentifier, value: value})
+			i = end
+
+		case isWordRune(current):
+
+			start := i
+			for i < len(runeList) && isWordRune(runeList[i]) {
+				i++
+			}
+			tokenList = append(tokenList, sqlTokenStruct{kind: tokenWord, value: string(runeList[start:i])})
+
+		default:
+
+			tokenList = append(tokenList, sqlTokenStruct{kind: tokenSymbol, value: string(current)})
+			i++
+		}
+	}
+
+	return tokenList
+}
+
+// читаем значение в кавычках, кавычка экранируется удвоением или обратным слэшем (для строк)
+func readQuoted(runeList []rune, start int, isBackslashEscape bool) (string, int) {
+
+	quote := runeList[start]
+	var value strings.Builder
+
+	i := start + 1
+	for i < len(runeList) {
+
+		current := runeList[i]
+		if isBackslashEscape && current == '\\' && i+1 < len(runeList) {
+
+			value.WriteRune(runeList[i+1])
+			i += 2
+			continue
+		}
+
+		if current == quote {
+
+			// удвоенная кавычка внутри значения
+			if i+1 < len(runeList) && runeList[i+1] == quote {
+
+				value.WriteRune(quote)
+				i += 2
+				continue
+			}
+			return value.String(), i + 1
+		}
+
+		value.WriteRune(current)
+		i++
+	}
+
+	return value.String(), i
+}
+
+// может ли символ быть частью слова
+func isWordRune(r rune) bool {
+
+	return r == '_' || r == '$' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// INSERT [LOW_PRIORITY | DELAYED | HIGH_PRIORITY] [IGNORE] [INTO] table
+func (parser *statementParserStruct) parseInsertTableList() []string {
+
+	parser.skipWordList("LOW_PRIORITY", "DELAYED", "HIGH_PRIORITY", "IGNORE", "INTO")
+	return getFirstName(parser.readNameList(false))
+}
+
+// UPDATE [LOW_PRIORITY] [IGNORE] table_references SET ...
+func (parser *statementParserStruct) parseUpdateTableList() []string {
+
+	parser.skipWordList("LOW_PRIORITY", "IGNORE")
+	tableList, _ := parser.readTableReferenceList("SET")
+	return tableList
+}
+
+// DELETE [LOW_PRIORITY] [QUICK] [IGNORE] FROM table
+// DELETE t1, t2 FROM table_references
+// DELETE FROM t1, t2 USING table_references
+func (parser *statementParserStruct) parseDeleteTableList() []string {
+
+	parser.skipWordList("LOW_PRIORITY", "QUICK", "IGNORE")
+
+	// в многотабличном удалении перед FROM перечислены изменяемые таблицы или их алиасы
+	var targetList []string
+	if !parser.isWord("FROM") {
+		targetList = parser.readNameList(false)
+	}
+
+	if !parser.isWord("FROM") {
+		return targetList
+	}
+	parser.position++
+
+	tableList, aliasMap := parser.readTableReferenceList("WHERE", "USING", "ORDER", "LIMIT")
+	if parser.isWord("USING") {
+
+		parser.position++
+		targetList = tableList
+		_, aliasMap = parser.readTableReferenceList("WHERE")
+	}
+
+	if len(targetList) == 0 {
+		return tableList
+	}
+
+	// переводим алиасы в имена таблиц
+	resolvedList := make([]string, 0, len(targetList))
+	for _, target := range targetList {
+
+		target = strings.TrimSuffix(target, ".*")
+		if table, exist := aliasMap[target]; exist {
+			target = table
+		}
+		resolvedList = append(resolvedList, target)
+	}
+
+	return resolvedList
+}
+
+// CREATE/DROP/ALTER [TEMPORARY] TABLE [IF [NOT] EXISTS] table, CREATE INDEX name ON table, CREATE USER ...
+func (parser *statementParserStruct) parseSchemaTableList() []string {
+
+	parser.skipWordList("OR", "REPLACE", "TEMPORARY", "UNIQUE", "FULLTEXT", "SPATIAL", "ONLINE", "OFFLINE", "IGNORE")
+
+	switch parser.upper() {
+	case "TABLE":
+
+		parser.position++
+		parser.skipWordList("IF", "NOT", "EXISTS")
+		return parser.readNameList(false)
+	case "INDEX":
+
+		if parser.skipUntilWord("ON") {
+			return getFirstName(parser.readNameList(false))
+		}
+	case "USER", "ROLE":
+		return privilegeTableList[:1]
+	}
+
+	return nil
+}
+
+// RENAME TABLE a TO b, c TO d / RENAME USER ...
+func (parser *statementParserStruct) parseRenameTableList() []string {
+
+	if parser.isWord("USER") {
+		return privilegeTableList[:1]
+	}
+
+	parser.skipWordList("TABLE", "TABLES")
+
+	var tableList []string
+	for parser.position < len(parser.tokenList) {
+
+		name, isRead := parser.readName()
+		if !isRead {
+			break
+		}
+		tableList = append(tableList, name)
+
+		if !parser.isWord("TO") && !parser.isSymbol(",") {
+			break
+		}
+		parser.position++
+	}
+
+	return tableList
+}
+
+// читаем список таблиц с join до стоп-слова, возвращаем таблицы и соответствие алиасов таблицам
+func (parser *statementParserStruct) readTableReferenceList(stopWordList ...string) ([]string, map[string]string) {
+
+	var tableList []string
+	aliasMap := make(map[string]string)
+
+	for parser.position < len(parser.tokenList) {
+
+		// производная таблица или подзапрос – пропускаем
+		if parser.isSymbol("(") {
+			parser.skipParenthesis()
+		} else {
+
+			name, isRead := parser.readName()
+			if !isRead {
+				break
+			}
+			tableList = append(tableList, name)
+			aliasMap[name] = name
+
+			if alias, isAlias := parser.readAlias(); isAlias {
+				aliasMap[alias] = name
+			}
+		}
+
+		// пропускаем условия join до следующей таблицы
+		if !parser.skipToNextReference(stopWordList) {
+			break
+		}
+	}
+
+	return tableList, aliasMap
+}
+
+// пропускаем токены до следующей таблицы в списке, false – список закончился
+func (parser *statementParserStruct) skipToNextReference(stopWordList []string) bool {
+
+	for parser.position < len(parser.tokenList) {
+
+		switch {
+		case parser.isSymbol(","):
+
+			parser.position++
+			return true
+		case parser.isSymbol("("):
+			parser.skipParenthesis()
+		case parser.isSymbol(";"):
+			return false
+		case parser.isKind(tokenWord) && joinWordMap[parser.upper()]:
+
+			parser.position++
+			return true
+		case parser.isKind(tokenWord) && functions.IsStringInSlice(parser.upper(), stopWordList):
+
+			// USING (column) – условие join, а не начало списка таблиц
+			if parser.upper() == "USING" && parser.isSymbolAt(parser.position+1, "(") {
+
+				parser.position++
+				continue
+			}
+			return false
+		default:
+			parser.position++
+		}
+	}
+
+	return false
+}
+
+// читаем список имен через запятую, с необязательными алиасами и режимом блокировки для LOCK TABLES
+func (parser *statementParserStruct) readNameList(isLockList bool) []string {
+
+	var tableList []string
+	for parser.position < len(parser.tokenList) {
+
+		name, isRead := parser.readName()
+		if !isRead {
+			break
+		}
+		tableList = append(tableList, name)
+
+		if isLockList {
+
+			parser.readAlias()
+			parser.skipWordList("READ", "LOCAL", "LOW_PRIORITY", "WRITE")
+		}
+
+		if !parser.isSymbol(",") {
+			break
+		}
+		parser.position++
+	}
+
+	return tableList
+}
+
+// оставляем только первое имя из списка
+func getFirstName(nameList []string) []string {
+
+	if len(nameList) > 1 {
+		return nameList[:1]
+	}
+
+	return nameList
+}
+
+// читаем имя вида name, db.name или db.*
+func (parser *statementParserStruct) readName() (string, bool) {
+
+	if !parser.isKind(tokenWord) && !parser.isKind(tokenIdentifier) {
+		return "", false
+	}
+
+	partList := []string{strings.ToLower(parser.tokenList[parser.position].value)}
+	parser.position++
+
+	for parser.isSymbol(".") {
+
+		parser.position++
+		if parser.isSymbol("*") {
+
+			partList = append(partList, "*")
+			parser.position++
+			break
+		}
+
+		if !parser.isKind(tokenWord) && !parser.isKind(tokenIdentifier) {
+			break
+		}
+		partList = append(partList, strings.ToLower(parser.tokenList[parser.position].value))
+		parser.position++
+	}
+
+	return strings.Join(partList, "."), true
+}
+
+// читаем алиас таблицы: AS alias или просто alias
+func (parser *statementParserStruct) readAlias() (string, bool) {
+
+	if parser.isWord("AS") {
+		parser.position++
+	}
+
+	if parser.isKind(tokenIdentifier) || (parser.isKind(tokenWord) && !notAliasWordMap[parser.upper()]) {
+
+		alias := strings.ToLower(parser.tokenList[parser.position].value)
+		parser.position++
+		return alias, true
+	}
+
+	return "", false
+}
+
+// пропускаем WITH [RECURSIVE] name [(columns)] AS (...) [, ...], запоминая имена
+func (parser *statementParserStruct) skipCommonTableExpressionList() {
+
+	parser.skipWordList("RECURSIVE")
+	for parser.position < len(parser.tokenList) {
+
+		name, isRead := parser.readName()
+		if !isRead {
+			return
+		}
+		parser.cteNameList[name] = true
+
+		if parser.isSymbol("(") {
+			parser.skipParenthesis()
+		}
+		parser.skipWordList("AS")
+		if parser.isSymbol("(") {
+			parser.skipParenthesis()
+		}
+
+		if !parser.isSymbol(",") {
+			return
+		}
+		parser.position++
+	}
+}
+
+// убираем из списка имена, объявленные в WITH
+func (parser *statementParserStruct) excludeCteNameList(tableList []string) []string {
+
+	if len(parser.cteNameList) == 0 {
+		return tableList
+	}
+
+	resultList := make([]string, 0, len(tableList))
+	for _, table := range tableList {
+
+		if !parser.cteNameList[table] {
+			resultList = append(resultList, table)
+		}
+	}
+
+	return resultList
+}
+
+// пропускаем скобки вместе с содержимым
+func (parser *statementParserStruct) skipParenthesis() {
+
+	depth := 0
+	for parser.position < len(parser.tokenList) {
+
+		if parser.isSymbol("(") {
+			depth++
+		} else if parser.isSymbol(")") {
+			depth--
+		}
+		parser.position++
+
+		if depth == 0 {
+			return
+		}
+	}
+}
+
+// пропускаем подряд идущие слова из списка
+func (parser *statementParserStruct) skipWordList(wordList ...string) {
+
+	for parser.isKind(tokenWord) && functions.IsStringInSlice(parser.upper(), wordList) {
+		parser.position++
+	}
+}
+
+// пропускаем токены до слова, встающего вне скобок, и само слово
+func (parser *statementParserStruct) skipUntilWord(word string) bool {
+
+	for parser.position < len(parser.tokenList) {
+
+		if parser.isSymbol("(") {
+
+			parser.skipParenthesis()
+			continue
+		}
+
+		isFound := parser.isWord(word)
+		parser.position++
+		if isFound {
+			return true
+		}
+	}
+
+	return false
+}
+
+// является ли текущий токен словом word
+func (parser *statementParserStruct) isWord(word string) bool {
+
+	return parser.isKind(tokenWord) && parser.upper() == word
+}
+
+// является ли текущий токен символом symbol
+func (parser *statementParserStruct) isSymbol(symbol string) bool {
+
+	return parser.isSymbolAt(parser.position, symbol)
+}
+
+// является ли токен на позиции символом symbol
+func (parser *statementParserStruct) isSymbolAt(position int, symbol string) bool {
+
+	return position < len(parser.tokenList) && parser.tokenList[position].kind == tokenSymbol && parser.tokenList[position].value == symbol
+}
+
+// является ли текущий токен токеном вида kind
+func (parser *statementParserStruct) isKind(kind int) bool {
+
+	return parser.position < len(parser.tokenList) && parser.tokenList[parser.position].kind == kind
+}
+
+// текущий токен в верхнем регистре
+func (parser *statementParserStruct) upper() string {
+
+	if parser.position >= len(parser.tokenList) {
+		return ""
+	}
+
+	return strings.ToUpper(parser.tokenList[parser.position].value)
+}
@@ -0,0 +1,160 @@
+package mysql
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// проверяем глагол и изменяемые таблицы
+func TestParseStatement(t *testing.T) {
+
+	caseList := []struct {
+		name      string
+		query     string
+		verb      string
+		tableList []string
+	}{
+		{"line comment --", "-- comment\nINSERT INTO `user` (`id`) VALUES (1)", "INSERT", []string{"user"}},
+		{"line comment #", "# comment\nUPDATE user SET name = 'a'", "UPDATE", []string{"user"}},
+		{"block comment", "/* comment */ DELETE FROM user WHERE id = 1", "DELETE", []string{"user"}},
+		{"version comment", "/*!40000 ALTER TABLE `user` DISABLE KEYS */", "ALTER", []string{"user"}},
+		{"verb before newline", "insert\ninto user (id) values (1)", "INSERT", []string{"user"}},
+		{"with update", "WITH cte AS (SELECT id FROM user_old) UPDATE user JOIN cte ON cte.id = user.id SET user.name = 'a'", "UPDATE", []string{"user"}},
+		{"multi-table delete", "DELETE u, s FROM user u JOIN session s ON s.user_id = u.id WHERE u.id = 1", "DELETE", []string{"user", "session"}},
+		{"multi-table delete using", "DELETE FROM user, session USING user JOIN session ON session.user_id = user.id", "DELETE", []string{"user", "session"}},
+		{"backticked db.table", "INSERT INTO `pivot_company_service`.`domino_registry` (id) VALUES (1)", "INSERT", []string{"pivot_company_service.domino_registry"}},
+		{"keywords in string", "SELECT * FROM user WHERE name = 'DELETE FROM user; UPDATE'", "SELECT", nil},
+		{"select for update", "SELECT * FROM user WHERE id = 1 FOR UPDATE", "SELECT", nil},
+		{"call", "CALL update_user(1)", "CALL", nil},
+		{"do", "DO RELEASE_LOCK('name')", "DO", nil},
+		{"handler", "HANDLER user READ FIRST", "HANDLER", nil},
+	}
+
+	for _, c := range caseList {
+
+		t.Run(c.name, func(t *testing.T) {
+
+			statement := parseStatement(c.query)
+			if statement.verb != c.verb {
+				t.Fatalf("verb = %q, want %q", statement.verb, c.verb)
+			}
+			if !reflect.DeepEqual(statement.tableList, c.tableList) {
+				t.Fatalf("tableList = %q, want %q", statement.tableList, c.tableList)
+			}
+		})
+	}
+}
+
+// проверяем, какие запросы считаются записью
+func TestIsWriteRows(t *testing.T) {
+
+	caseList := []struct {
+		name    string
+		query   string
+		isWrite bool
+	}{
+		{"line comment --", "-- SELECT\nINSERT INTO user (id) VALUES (1)", true},
+		{"line comment #", "# SELECT\nDELETE FROM user", true},
+		{"block comment", "/* SELECT */ UPDATE user SET name = 'a'", true},
+		{"comment hides write", "/* DELETE FROM user */ SELECT 1", false},
+		{"version comment", "/*!40000 ALTER TABLE user DISABLE KEYS */", true},
+		{"verb before newline", "insert\ninto user (id) values (1)", true},
+		{"with update", "WITH cte AS (SELECT 1 AS id) UPDATE user JOIN cte ON cte.id = user.id SET name = 'a'", true},
+		{"with select", "WITH cte AS (SELECT 1 AS id) SELECT * FROM cte", false},
+		{"multi-table delete", "DELETE u FROM user u WHERE u.id = 1", true},
+		{"keywords in string", "SELECT 'DELETE FROM user'", false},
+		{"select for update", "SELECT * FROM user WHERE id = 1 FOR UPDATE", false},
+		{"call", "CALL update_user(1)", true},
+		{"do", "DO RELEASE_LOCK('name')", true},
+		{"handler", "HANDLER user READ FIRST", false},
+		{"empty", "", false},
+	}
+
+	for _, c := range caseList {
+
+		t.Run(c.name, func(t *testing.T) {
+
+			if isWriteRows(c.query) != c.isWrite {
+				t.Fatalf("isWriteRows(%q) = %v, want %v", c.query, !c.isWrite, c.isWrite)
+			}
+		})
+	}
+}
+
+// проверяем политику записи на резервном сервере
+func TestCheckWritePolicy(t *testing.T) {
+
+	defer SetWritePolicy(nil)
+	defer SetReserveWriteMode(ReserveWriteModeSilent)
+
+	SetWritePolicy(NewConfigWritePolicy(WritePolicyConfigStruct{DatabaseList: map[string][]string{
+		"pivot_company_service": {"domino_registry"},
+		"company_*":             {"user_%s"},
+	}}))
+
+	caseList := []struct {
+		name      string
+		dbKey     string
+		query     string
+		isBlocked bool
+	}{
+		{"allowed table", "pivot_company_service", "UPDATE domino_registry SET is_busy = 1", false},
+		{"allowed by pattern", "company_1", "INSERT INTO `user_list` (id) VALUES (1)", false},
+		{"allowed behind comment", "pivot_company_service", "/* x */ DELETE FROM `domino_registry` WHERE id = 1", false},
+		{"other table", "pivot_company_service", "UPDATE user SET name = 'a'", true},
+		{"one of tables not allowed", "company_1", "DELETE u, s FROM user_list u JOIN session s ON s.id = u.id", true},
+		{"db.table of other db", "company_1", "INSERT INTO `pivot_company_service`.`domino_registry` (id) VALUES (1)", false},
+		{"table name only in string", "pivot_company_service", "UPDATE user SET name = 'domino_registry'", true},
+		{"call without tables", "pivot_company_service", "CALL update_registry()", true},
+		{"do without tables", "pivot_company_service", "DO RELEASE_LOCK('name')", true},
+	}
+
+	for _, c := range caseList {
+
+		t.Run(c.name, func(t *testing.T) {
+
+			SetReserveWriteMode(ReserveWriteModeSilent)
+			isBlocked, err := checkWritePolicy(c.dbKey, c.query)
+			if isBlocked != c.isBlocked || err != nil {
+				t.Fatalf("silent mode: isBlocked = %v, err = %v, want %v", isBlocked, err, c.isBlocked)
+			}
+
+			SetReserveWriteMode(ReserveWriteModeError)
+			isBlocked, err = checkWritePolicy(c.dbKey, c.query)
+			if isBlocked != c.isBlocked || errors.Is(err, ErrWriteBlockedOnReserve) != c.isBlocked {
+				t.Fatalf("error mode: isBlocked = %v, err = %v, want %v", isBlocked, err, c.isBlocked)
+			}
+		})
+	}
+}
+
+// проверяем, какие запросы считаются блокирующим чтением
+func TestIsLockingRead(t *testing.T) {
+
+	caseList := []struct {
+		name      string
+		query     string
+		isLocking bool
+	}{
+		{"for update", "SELECT * FROM user WHERE id = 1 FOR UPDATE", true},
+		{"for update lower case", "select * from user where id = 1\nfor  update skip locked", true},
+		{"for share", "SELECT * FROM user WHERE id = 1 FOR SHARE", true},
+		{"lock in share mode", "SELECT * FROM user WHERE id = 1 LOCK IN SHARE MODE", true},
+		{"locking subquery", "SELECT * FROM (SELECT id FROM user FOR UPDATE) t", true},
+		{"plain select", "SELECT * FROM user WHERE id = 1", false},
+		{"keywords in string", "SELECT * FROM user WHERE name = 'FOR UPDATE'", false},
+		{"keywords in comment", "SELECT * FROM user /* FOR UPDATE */", false},
+		{"backticked column", "SELECT `for`, `update` FROM user", false},
+	}
+
+	for _, c := range caseList {
+
+		t.Run(c.name, func(t *testing.T) {
+
+			if isLockingRead(c.query) != c.isLocking {
+				t.Fatalf("isLockingRead(%q) = %v, want %v", c.query, !c.isLocking, c.isLocking)
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package mysql
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"sync"
+)
+
+// -------------------------------------------------------
+// кэш подготовленных запросов пула
+// часто повторяющиеся запросы подготавливаются на сервере один раз,
+// при переполнении вытесняется давно не использованный запрос
+// -------------------------------------------------------
+
+// StatementCacheStatsStruct статистика кэша подготовленных запросов
+type StatementCacheStatsStruct struct {
+	Capacity  int     // максимальный размер кэша
+	Size      int     // сколько запросов сейчас в кэше
+	HitCount  int64   // сколько раз запрос нашелся в кэше
+	MissCount int64   // сколько раз запрос пришлось подготовить
+	HitRate   float64 // доля попаданий от 0 до 1
+}
+
+// кэш подготовленных запросов
+type statementCacheStruct struct {
+	mu        sync.Mutex
+	capacity  int
+	list      *list.List               // от недавно использованных к давно не использованным
+	itemMap   map[string]*list.Element // запрос -> элемент списка
+	hitCount  int64
+	missCount int64
+	isClosed  bool // кэш сброшен, новые запросы в него не добавляются
+}
+
+// подготовленный запрос в кэше
+type statementItemStruct struct {
+	query     string
+	stmt      *sql.Stmt
+	useCount  int  // сколько запросов сейчас выполняется
+	isEvicted bool // вытеснен из кэша, закрывается после последнего использования
+}
+
+// -------------------------------------------------------
+// PUBLIC
+// -------------------------------------------------------
+
+// SetStatementCache включаем кэш подготовленных запросов на capacity запросов, 0 – выключаем
+// при изменении размера кэш очищается
+func (connectionItem *ConnectionPoolItem) SetStatementCache(capacity int) {
+
+	var newCache *statementCacheStruct
+	if capacity > 0 {
+		newCache = newStatementCache(capacity)
+	}
+
+	if oldCache := connectionItem.statementCache.Swap(newCache); oldCache != nil {
+		oldCache.close()
+	}
+}
+
+// GetStatementCacheStats получаем статистику кэша подготовленных запросов
+func (connectionItem *ConnectionPoolItem) GetStatementCacheStats() StatementCacheStatsStruct {
+
+	cache := connectionItem.statementCache.Load()
+	if cache == nil {
+		return StatementCacheStatsStruct{}
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	stats := StatementCacheStatsStruct{
+		Capacity:  cache.capacity,
+		Size:      cache.list.Len(),
+		HitCount:  cache.hitCount,
+		MissCount: cache.missCount,
+	}
+	if total := stats.HitCount + stats.MissCount; total > 0 {
+		stats.HitRate = float64(stats.HitCount) / float64(total)
+	}
+
+	return stats
+}
+
+// -------------------------------------------------------
+// PROTECTED
+// -------------------------------------------------------
+
+// создаем кэш
+func newStatementCache(capacity int) *statementCacheStruct {
+
+	return &statementCacheStruct{
+		capacity: capacity,
+		list:     list.New(),
+		itemMap:  make(map[string]*list.Element, capacity),
+	}
+}
+
+// выполняем запрос на изменение, через кэш, если он включен
+func (connectionItem *ConnectionPoolItem) execWithCache(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+
+	cache := connectionItem.statementCache.Load()
+	if cache == nil {
+		return connectionItem.GetConnectionPool().ExecContext(ctx, query, args...)
+	}
+
+	item := cache.acquire(ctx, connectionItem.GetConnectionPool(), query)
+	if item == nil {
+		return connectionItem.GetConnectionPool().ExecContext(ctx, query, args...)
+	}
+	defer cache.release(item)
+
+	return item.stmt.ExecContext(ctx, args...)
+}
+
+// выполняем запрос на чтение, через кэш, если он включен
+func (connectionItem *ConnectionPoolItem) queryWithCache(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+
+	cache := connectionItem.statementCache.Load()
+	if cache == nil {
+		return connectionItem.GetConnectionPool().QueryContext(ctx, query, args...)
+	}
+
+	item := cache.acquire(ctx, connectionItem.GetConnectionPool(), query)
+	if item == nil {
+		return connectionItem.GetConnectionPool().QueryContext(ctx, query, args...)
+	}
+
+	// открытые строки держат запрос сами, поэтому отпускаем его сразу
+	defer cache.release(item)
+
+	return item.stmt.QueryContext(ctx, args...)
+}
+
+// включаем кэш того же размера, что у старого пула, и закрываем запросы старого пула
+func (connectionItem *ConnectionPoolItem) inheritStatementCache(oldItem *ConnectionPoolItem) {
+
+	oldCache := oldItem.statementCache.Swap(nil)
+	if oldCache == nil {
+		return
+	}
+
+	connectionItem.SetStatementCache(oldCache.capacity)
+	oldCache.close()
+}
+
+// получаем подготовленный запрос, nil – запрос не удалось подготовить, его нужно выполнить напрямую
+func (cache *statementCacheStruct) acquire(ctx context.Context, connectionPool *sql.DB, query string) *statementItemStruct {
+
+	cache.mu.Lock()
+	if element, exist := cache.itemMap[query]; exist {
+
+		item := element.Value.(*statementItemStruct)
+		item.useCount++
+		cache.hitCount++
+		cache.list.MoveToFront(element)
+		cache.mu.Unlock()
+		return item
+	}
+	cache.missCount++
+	cache.mu.Unlock()
+
+	// подготавливаем без блокировки, чтобы не задерживать остальные запросы
+	// не все запросы можно подготовить, такие выполняем напрямую
+	stmt, err := connectionPool.PrepareContext(ctx, query)
+	if err != nil {
+		return nil
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	// кэш сбросили, пока готовили запрос
+	if cache.isClosed {
+
+		_ = stmt.Close()
+		return nil
+	}
+
+	// запрос мог подготовить параллельный вызов – тогда используем его
+	if element, exist := cache.itemMap[query]; exist {
+
+		_ = stmt.Close()
+		item := element.Value.(*statementItemStruct)
+		item.useCount++
+		return item
+	}
+
+	item := &statementItemStruct{query: query, stmt: stmt, useCount: 1}
+	cache.itemMap[query] = cache.list.PushFront(item)
+
+	for cache.list.Len() > cache.capacity {
+		cache.evict(cache.list.Back())
+	}
+
+	return item
+}
+
+// отпускаем подготовленный запрос после выполнения
+func (cache *statementCacheStruct) release(item *statementItemStruct) {
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	item.useCount--
+	if item.isEvicted && item.useCount == 0 {
+		_ = item.stmt.Close()
+	}
+}
+
+// вытесняем запрос из кэша, используемый запрос закроется в release
+func (cache *statementCacheStruct) evict(element *list.Element) {
+
+	item := cache.list.Remove(element).(*statementItemStruct)
+	delete(cache.itemMap, item.query)
+
+	item.isEvicted = true
+	if item.useCount == 0 {
+		_ = item.stmt.Close()
+	}
+}
+
+// очищаем кэш и закрываем подготовленные запросы
+func (cache *statementCacheStruct) close() {
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.isClosed = true
+	for cache.list.Len() > 0 {
+		cache.evict(cache.list.Back())
+	}
+}
@@ -0,0 +1,455 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// -------------------------------------------------------
+// запись структур с тегами sqlname
+// колонки идут в порядке полей структуры, поэтому текст запроса всегда один и тот же
+// и подготовленный запрос переиспользуется кэшем запросов пула
+// опция pk помечает колонки первичного ключа, omitempty – колонку, которая не пишется при нулевом значении
+// -------------------------------------------------------
+
+// опция тега, исключающая колонку с нулевым значением из запроса
+const sqlTagOptionOmitEmpty = "omitempty"
+
+// поле структуры, которое пишется в колонку
+type structFieldStruct struct {
+	index []int
+	tag   sqlTagStruct
+}
+
+// колонка структуры со значением для записи
+type structColumnStruct struct {
+	name         string // имя колонки в обратных кавычках
+	value        interface{}
+	isPrimaryKey bool
+	isInteger    bool // целочисленная колонка, ее значение можно вернуть через LAST_INSERT_ID
+}
+
+// кэш полей структуры для каждого типа
+var structFieldListCache = sync.Map{}
+
+// -------------------------------------------------------
+// PUBLIC
+// -------------------------------------------------------
+
+// InsertStruct вставляем структуру, возвращаем id вставленной строки
+func (connectionItem *ConnectionPoolItem) InsertStruct(ctx context.Context, tableName string, row interface{}, isIgnore bool) (int64, error) {
+
+	query, argList, err := formatStructInsert(tableName, row, isIgnore)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := connectionItem.execStructQuery(ctx, query, argList...)
+	if err != nil || res == nil {
+		return 0, err
+	}
+
+	lastInsertId, _ := res.LastInsertId()
+	return lastInsertId, nil
+}
+
+// UpdateStruct обновляем строку по первичному ключу, возвращаем количество измененных строк
+func (connectionItem *ConnectionPoolItem) UpdateStruct(ctx context.Context, tableName string, row interface{}) (int64, error) {
+
+	query, argList, err := formatStructUpdate(tableName, row)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := connectionItem.execStructQuery(ctx, query, argList...)
+	if err != nil || res == nil {
+		return 0, err
+	}
+
+	rows, _ := res.RowsAffected()
+	return rows, nil
+}
+
+// UpsertStruct вставляем структуру или обновляем существующую строку, возвращаем id строки
+func (connectionItem *ConnectionPoolItem) UpsertStruct(ctx context.Context, tableName string, row interface{}) (int64, error) {
+
+	query, argList, err := formatStructUpsert(tableName, row)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := connectionItem.execStructQuery(ctx, query, argList...)
+	if err != nil || res == nil {
+		return 0, err
+	}
+
+	lastInsertId, _ := res.LastInsertId()
+	return lastInsertId, nil
+}
+
+// InsertStruct вставляем структуру в транзакции, возвращаем id вставленной строки
+func (transactionItem *TransactionStruct) InsertStruct(ctx context.Context, tableName string, row interface{}, isIgnore bool) (int64, error) {
+
+	query, argList, err := formatStructInsert(tableName, row, isIgnore)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := transactionItem.execStructQuery(ctx, query, argList...)
+	if err != nil || res == nil {
+		return 0, err
+	}
+
+	lastInsertId, _ := res.LastInsertId()
+	return lastInsertId, nil
+}
+
+// UpdateStruct обновляем строку по первичному ключу в транзакции, возвращаем количество измененных строк
+func (transactionItem *TransactionStruct) UpdateStruct(ctx context.Context, tableName string, row interface{}) (int64, error) {
+
+	query, argList, err := formatStructUpdate(tableName, row)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := transactionItem.execStructQuery(ctx, query, argList...)
+	if err != nil || res == nil {
+		return 0, err
+	}
+
+	rows, _ := res.RowsAffected()
+	return rows, nil
+}
+
+// UpsertStruct вставляем структуру или обновляем существующую строку в транзакции, возвращаем id строки
+func (transactionItem *TransactionStruct) UpsertStruct(ctx context.Context, tableName string, row interface{}) (int64, error) {
+
+	query, argList, err := formatStructUpsert(tableName, row)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := transactionItem.execStructQuery(ctx, query, argList...)
+	if err != nil || res == nil {
+		return 0, err
+	}
+
+	lastInsertId, _ := res.LastInsertId()
+	return lastInsertId, nil
+}
+
+// -------------------------------------------------------
+// PROTECTED
+// -------------------------------------------------------
+
+// выполняем запрос на запись через пул, на резервном сервере результат пустой
+func (connectionItem *ConnectionPoolItem) execStructQuery(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+
+	// если резервный и запрос меняет бд
+	if isBlocked, err := checkWriteOnReserve(connectionItem.dbKey, query); isBlocked {
+		return nil, err
+	}
+
+	queryCtx, cancel := connectionItem.withQueryTimeout(ctx)
+	defer cancel()
+
+	res, err := connectionItem.execContext(queryCtx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query: %s, error: %w", query, err)
+	}
+
+	return res, nil
+}
+
+// выполняем запрос на запись в транзакции, на резервном сервере результат пустой
+func (transactionItem *TransactionStruct) execStructQuery(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+
+	// если резервный и запрос меняет бд
+	if isBlocked, err := checkWriteOnReserve(transactionItem.dbKey, query); isBlocked {
+		return nil, err
+	}
+
+	queryCtx, cancel := transactionItem.withQueryTimeout(ctx)
+	defer cancel()
+
+	res, err := transactionItem.execContext(queryCtx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("transaction query: %s, error: %w", query, err)
+	}
+
+	return res, nil
+}
+
+// готовим запрос вставки структуры
+func formatStructInsert(tableName string, row interface{}, isIgnore bool) (string, []interface{}, error) {
+
+	quotedTableName, err := quoteIdentifier(tableName)
+	if err != nil {
+		return "", nil, err
+	}
+
+	columnList, err := getStructColumnList(row)
+	if err != nil {
+		return "", nil, err
+	}
+
+	ignore := ""
+	if isIgnore {
+		ignore = "IGNORE "
+	}
+
+	nameList, placeholderList, argList := splitStructColumnList(columnList)
+	query := fmt.Sprintf("INSERT %sINTO %s (%s) VALUES (%s)",
+		ignore, quotedTableName, strings.Join(nameList, ", "), strings.Join(placeholderList, ", "))
+
+	return query, argList, nil
+}
+
+// готовим запрос обновления структуры по первичному ключу
+func formatStructUpdate(tableName string, row interface{}) (string, []interface{}, error) {
+
+	quotedTableName, err := quoteIdentifier(tableName)
+	if err != nil {
+		return "", nil, err
+	}
+
+	columnList, err := getStructColumnList(row)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var setList, whereList []string
+	var setArgList, whereArgList []interface{}
+	for _, column := range columnList {
+
+		if column.isPrimaryKey {
+
+			whereList = append(whereList, fmt.Sprintf("%s = ?", column.name))
+			whereArgList = append(whereArgList, column.value)
+			continue
+		}
+
+		setList = append(setList, fmt.Sprintf("%s = ?", column.name))
+		setArgList = append(setArgList, column.value)
+	}
+
+	if len(whereList) == 0 {
+		return "", nil, fmt.Errorf("struct %T has no primary key column", row)
+	}
+	if len(setList) == 0 {
+		return "", nil, fmt.Errorf("struct %T has no columns to update", row)
+	}
+
+	query := fmt.Sprintf("UPDATE %s SET %s WHERE %s LIMIT 1",
+		quotedTableName, strings.Join(setList, ", "), strings.Join(whereList, " AND "))
+
+	return query, append(setArgList, whereArgList...), nil
+}
+
+// готовим запрос вставки структуры с обновлением при совпадении ключа
+// обновляются все колонки, кроме первичного ключа; если ключ один и целочисленный,
+// он передается в LAST_INSERT_ID, чтобы и при обновлении вернуть id существующей строки
+func formatStructUpsert(tableName string, row interface{}) (string, []interface{}, error) {
+
+	quotedTableName, err := quoteIdentifier(tableName)
+	if err != nil {
+		return "", nil, err
+	}
+
+	columnList, err := getStructColumnList(row)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// ключ берем из полей структуры: omitempty ключ с нулевым значением в колонки не попал, но LAST_INSERT_ID ему нужен
+	primaryKeyList, err := getStructPrimaryKeyList(row)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var updateList []string
+	if len(primaryKeyList) == 1 && primaryKeyList[0].isInteger {
+
+		primaryKey := primaryKeyList[0].name
+		updateList = append(updateList, fmt.Sprintf("%s = LAST_INSERT_ID(%s)", primaryKey, primaryKey))
+	}
+
+	// без первичного ключа в структуре строку находит другой уникальный ключ – тогда обновляются все колонки
+	for _, column := range columnList {
+
+		if column.isPrimaryKey {
+			continue
+		}
+
+		updateList = append(updateList, fmt.Sprintf("%s = VALUES(%s)", column.name, column.name))
+	}
+
+	if len(updateList) == 0 {
+		return "", nil, fmt.Errorf("struct %T has no columns to update", row)
+	}
+
+	nameList, placeholderList, argList := splitStructColumnList(columnList)
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON DUPLICATE KEY UPDATE %s",
+		quotedTableName, strings.Join(nameList, ", "), strings.Join(placeholderList, ", "), strings.Join(updateList, ", "))
+
+	return query, argList, nil
+}
+
+// получаем колонки структуры в порядке полей, колонки omitempty с нулевым значением пропускаем
+func getStructColumnList(row interface{}) ([]structColumnStruct, error) {
+
+	v := reflect.ValueOf(row)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("row must be a struct or pointer to struct, got %T", row)
+	}
+
+	var columnList []structColumnStruct
+	for _, structField := range getStructFieldList(v.Type()) {
+
+		field := v.FieldByIndex(structField.index)
+		if structField.tag.optionList[sqlTagOptionOmitEmpty] && field.IsZero() {
+			continue
+		}
+
+		name, err := quoteIdentifier(structField.tag.name)
+		if err != nil {
+			return nil, fmt.Errorf("struct %T: %w", row, err)
+		}
+
+		value, err := getSqlFieldValue(field, structField.tag)
+		if err != nil {
+			return nil, err
+		}
+
+		columnList = append(columnList, structColumnStruct{
+			name:         name,
+			value:        value,
+			isPrimaryKey: structField.tag.optionList[sqlTagOptionPrimaryKey],
+			isInteger:    isIntegerKind(field.Kind()),
+		})
+	}
+
+	if len(columnList) == 0 {
+		return nil, fmt.Errorf("struct %T has no columns to write", row)
+	}
+
+	return columnList, nil
+}
+
+// получаем колонки первичного ключа структуры без значений, включая пропущенные omitempty
+func getStructPrimaryKeyList(row interface{}) ([]structColumnStruct, error) {
+
+	structType := reflect.TypeOf(row)
+	if structType.Kind() == reflect.Ptr {
+		structType = structType.Elem()
+	}
+
+	var primaryKeyList []structColumnStruct
+	for _, structField := range getStructFieldList(structType) {
+
+		if !structField.tag.optionList[sqlTagOptionPrimaryKey] {
+			continue
+		}
+
+		name, err := quoteIdentifier(structField.tag.name)
+		if err != nil {
+			return nil, fmt.Errorf("struct %T: %w", row, err)
+		}
+
+		primaryKeyList = append(primaryKeyList, structColumnStruct{
+			name:         name,
+			isPrimaryKey: true,
+			isInteger:    isIntegerKind(structType.FieldByIndex(structField.index).Type.Kind()),
+		})
+	}
+
+	return primaryKeyList, nil
+}
+
+// получаем поля структуры с тегом sqlname, включая поля встроенных структур без тега
+func getStructFieldList(structType reflect.Type) []structFieldStruct {
+
+	if cached, exist := structFieldListCache.Load(structType); exist {
+		return cached.([]structFieldStruct)
+	}
+
+	fieldList := collectStructFieldList(structType, nil, nil)
+
+	structFieldListCache.Store(structType, fieldList)
+	return fieldList
+}
+
+// собираем поля структуры рекурсивно
+func collectStructFieldList(structType reflect.Type, parentIndex []int, fieldList []structFieldStruct) []structFieldStruct {
+
+	for i := 0; i < structType.NumField(); i++ {
+
+		field := structType.Field(i)
+		index := append(append([]int{}, parentIndex...), i)
+
+		tag, ok := parseSqlTag(field)
+
+		// встроенную структуру без тега разбираем рекурсивно
+		if !ok && field.Anonymous && field.Type.Kind() == reflect.Struct {
+
+			fieldList = collectStructFieldList(field.Type, index, fieldList)
+			continue
+		}
+
+		if !ok || !field.IsExported() {
+			continue
+		}
+
+		fieldList = append(fieldList, structFieldStruct{index: index, tag: tag})
+	}
+
+	return fieldList
+}
+
+// делим колонки на имена, плейсхолдеры и значения
+func splitStructColumnList(columnList []structColumnStruct) ([]string, []string, []interface{}) {
+
+	nameList := make([]string, 0, len(columnList))
+	placeholderList := make([]string, 0, len(columnList))
+	argList := make([]interface{}, 0, len(columnList))
+	for _, column := range columnList {
+
+		nameList = append(nameList, column.name)
+		placeholderList = append(placeholderList, "?")
+		argList = append(argList, column.value)
+	}
+
+	return nameList, placeholderList, argList
+}
+
+// проверяем, что тип целочисленный
+func isIntegerKind(kind reflect.Kind) bool {
+
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	default:
+		return false
+	}
+}
+
+// получаем ключи в алфавитном порядке, чтобы текст запроса не зависел от порядка обхода map
+func getSortedKeyList(insert map[string]interface{}) []string {
+
+	keyList := make([]string, 0, len(insert))
+	for key := range insert {
+		keyList = append(keyList, key)
+	}
+	sort.Strings(keyList)
+
+	return keyList
+}
@@ -0,0 +1,87 @@
+package mysql
+
+import (
+	"reflect"
+	"testing"
+)
+
+// проверяем запрос вставки структуры с обновлением
+func TestFormatStructUpsert(t *testing.T) {
+
+	type userStruct struct {
+		Id   int64  `sqlname:"id,pk,omitempty"`
+		Name string `sqlname:"name"`
+	}
+
+	type pairStruct struct {
+		UserId int64 `sqlname:"user_id,pk"`
+		ChatId int64 `sqlname:"chat_id,pk"`
+		Role   int   `sqlname:"role"`
+	}
+
+	caseList := []struct {
+		name    string
+		row     interface{}
+		query   string
+		argList []interface{}
+	}{
+		{
+			"omitted pk",
+			userStruct{Name: "a"},
+			"INSERT INTO `user` (`name`) VALUES (?) ON DUPLICATE KEY UPDATE `id` = LAST_INSERT_ID(`id`), `name` = VALUES(`name`)",
+			[]interface{}{"a"},
+		},
+		{
+			"pk with value",
+			&userStruct{Id: 5, Name: "a"},
+			"INSERT INTO `user` (`id`, `name`) VALUES (?, ?) ON DUPLICATE KEY UPDATE `id` = LAST_INSERT_ID(`id`), `name` = VALUES(`name`)",
+			[]interface{}{int64(5), "a"},
+		},
+		{
+			"composite pk",
+			pairStruct{UserId: 1, ChatId: 2, Role: 3},
+			"INSERT INTO `user` (`user_id`, `chat_id`, `role`) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE `role` = VALUES(`role`)",
+			[]interface{}{int64(1), int64(2), 3},
+		},
+	}
+
+	for _, c := range caseList {
+
+		t.Run(c.name, func(t *testing.T) {
+
+			query, argList, err := formatStructUpsert("user", c.row)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if query != c.query {
+				t.Fatalf("query = %q, want %q", query, c.query)
+			}
+			if !reflect.DeepEqual(argList, c.argList) {
+				t.Fatalf("argList = %v, want %v", argList, c.argList)
+			}
+		})
+	}
+}
+
+// проверяем, что запись структур не принимает некорректные идентификаторы
+func TestFormatStructIdentifier(t *testing.T) {
+
+	type rowStruct struct {
+		Id   int64  `sqlname:"id,pk"`
+		Name string `sqlname:"name = 1, x"`
+	}
+
+	type userStruct struct {
+		Id int64 `sqlname:"id,pk"`
+	}
+
+	if _, _, err := formatStructInsert("user", rowStruct{Id: 1}, false); err == nil {
+		t.Fatalf("expected error for incorrect column of struct")
+	}
+	if _, _, err := formatStructUpdate("user`; --", userStruct{Id: 1}); err == nil {
+		t.Fatalf("expected error for incorrect table of struct")
+	}
+	if _, _, err := formatStructUpsert("user", rowStruct{Id: 1}); err == nil {
+		t.Fatalf("expected error for incorrect column of struct upsert")
+	}
+}
@@ -0,0 +1,95 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// -------------------------------------------------------
+// таймауты запросов
+// у каждого пула свой таймаут по умолчанию, отдельный вызов может переопределить его через контекст,
+// если у контекста уже есть более близкий дедлайн – он и используется
+// -------------------------------------------------------
+
+// ключ контекста для таймаута отдельного вызова
+type queryTimeoutKeyStruct struct{}
+
+// -------------------------------------------------------
+// PUBLIC
+// -------------------------------------------------------
+
+// WithQueryTimeout задаем таймаут для запросов, выполняемых с этим контекстом, вместо таймаута пула
+// timeout <= 0 – таймаут не применяется, запрос ограничен только самим контекстом
+func WithQueryTimeout(ctx context.Context, timeout time.Duration) context.Context {
+
+	return context.WithValue(ctx, queryTimeoutKeyStruct{}, timeout)
+}
+
+// SetQueryTimeout устанавливаем таймаут запросов пула и его транзакций, 0 – QueryTimeout
+func (connectionItem *ConnectionPoolItem) SetQueryTimeout(timeout time.Duration) {
+
+	connectionItem.queryTimeout.Store(int64(timeout))
+}
+
+// BeginTransactionContext начинаем транзакцию с контекстом
+// контекст ограничивает всю транзакцию: при его отмене транзакция откатывается,
+// поэтому таймаут запросов к нему не применяется
+func (connectionItem *ConnectionPoolItem) BeginTransactionContext(ctx context.Context, opts *sql.TxOptions) (TransactionStruct, error) {
+
+	tx, err := connectionItem.GetConnectionPool().BeginTx(ctx, opts)
+	if err != nil {
+		return TransactionStruct{dbKey: connectionItem.dbKey}, err
+	}
+
+	return TransactionStruct{transaction: tx, dbKey: connectionItem.dbKey, connectionItem: connectionItem}, nil
+}
+
+// -------------------------------------------------------
+// PROTECTED
+// -------------------------------------------------------
+
+// получаем таймаут запросов пула
+func (connectionItem *ConnectionPoolItem) getQueryTimeout() time.Duration {
+
+	if connectionItem == nil {
+		return QueryTimeout
+	}
+
+	if timeout := time.Duration(connectionItem.queryTimeout.Load()); timeout > 0 {
+		return timeout
+	}
+
+	return QueryTimeout
+}
+
+// ограничиваем контекст запроса пула таймаутом
+func (connectionItem *ConnectionPoolItem) withQueryTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+
+	return withQueryTimeout(ctx, connectionItem.getQueryTimeout())
+}
+
+// ограничиваем контекст запроса транзакции таймаутом пула, в котором она начата
+func (transactionItem *TransactionStruct) withQueryTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+
+	return withQueryTimeout(ctx, transactionItem.connectionItem.getQueryTimeout())
+}
+
+// ограничиваем контекст таймаутом: из контекста, если задан, иначе переданным
+// если дедлайн контекста наступит раньше, контекст не оборачиваем
+func withQueryTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+
+	if override, ok := ctx.Value(queryTimeoutKeyStruct{}).(time.Duration); ok {
+		timeout = override
+	}
+
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= timeout {
+		return ctx, func() {}
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,113 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/getCompassUtils/go_base_frame/api/system/log"
+)
+
+// -------------------------------------------------------
+// выполнение функции в транзакции
+// транзакция подтверждается, если функция вернула nil,
+// и откатывается при ошибке или панике
+// вложенные вызовы работают через SAVEPOINT
+// -------------------------------------------------------
+
+// префикс имени точки сохранения
+const savepointPrefix = "sp_"
+
+// -------------------------------------------------------
+// PUBLIC
+// -------------------------------------------------------
+
+// RunInTransaction выполняем функцию в транзакции
+// opts задает уровень изоляции и режим только для чтения, nil – настройки сервера
+func (connectionItem *ConnectionPoolItem) RunInTransaction(ctx context.Context, opts *sql.TxOptions, callback func(transactionItem *TransactionStruct) error) error {
+
+	// начинаем транзакцию
+	tx, err := connectionItem.GetConnectionPool().BeginTx(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("unable begin transaction, error: %w", err)
+	}
+	transactionItem := &TransactionStruct{transaction: tx, dbKey: connectionItem.dbKey, connectionItem: connectionItem}
+
+	// при панике откатываем транзакцию и пробрасываем панику дальше
+	defer func() {
+
+		if recovered := recover(); recovered != nil {
+
+			_ = transactionItem.Rollback()
+			panic(recovered)
+		}
+	}()
+
+	err = callback(transactionItem)
+	if err != nil {
+
+		_ = transactionItem.Rollback()
+		return err
+	}
+
+	return transactionItem.Commit()
+}
+
+// RunInTransaction выполняем функцию во вложенной транзакции через точку сохранения
+// при ошибке откатываются только изменения, сделанные внутри функции
+func (transactionItem *TransactionStruct) RunInTransaction(ctx context.Context, callback func(transactionItem *TransactionStruct) error) error {
+
+	transactionItem.savepointCount++
+	savepoint := fmt.Sprintf("%s%d", savepointPrefix, transactionItem.savepointCount)
+
+	_, err := transactionItem.execSavepointQuery(ctx, "SAVEPOINT "+savepoint)
+	if err != nil {
+		return fmt.Errorf("unable create savepoint %s, error: %w", savepoint, err)
+	}
+
+	// при панике откатываемся к точке сохранения и пробрасываем панику дальше
+	defer func() {
+
+		if recovered := recover(); recovered != nil {
+
+			transactionItem.rollbackToSavepoint(ctx, savepoint)
+			panic(recovered)
+		}
+	}()
+
+	err = callback(transactionItem)
+	if err != nil {
+
+		transactionItem.rollbackToSavepoint(ctx, savepoint)
+		return err
+	}
+
+	_, err = transactionItem.execSavepointQuery(ctx, "RELEASE SAVEPOINT "+savepoint)
+	if err != nil {
+		return fmt.Errorf("unable release savepoint %s, error: %w", savepoint, err)
+	}
+
+	return nil
+}
+
+// -------------------------------------------------------
+// PROTECTED
+// -------------------------------------------------------
+
+// откатываемся к точке сохранения
+func (transactionItem *TransactionStruct) rollbackToSavepoint(ctx context.Context, savepoint string) {
+
+	_, err := transactionItem.execSavepointQuery(ctx, "ROLLBACK TO SAVEPOINT "+savepoint)
+	if err != nil {
+		log.Errorf("unable rollback to savepoint %s, error: %v", savepoint, err)
+	}
+}
+
+// выполняем запрос точки сохранения с таймаутом пула
+func (transactionItem *TransactionStruct) execSavepointQuery(ctx context.Context, query string) (sql.Result, error) {
+
+	queryContext, cancel := transactionItem.withQueryTimeout(ctx)
+	defer cancel()
+
+	return transactionItem.transaction.ExecContext(queryContext, query)
+}
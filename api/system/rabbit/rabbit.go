@@ -14,15 +14,20 @@ const (
 	routinesMax                  = 50  // сколько рутин может одновременно обрабатывать сообщения из очереди
 	messagesToConsumerPerRequest = 100 // сколько сообщений брать за раз на выполнение (глубина продавливания)
 	exchangeType                 = "fanout"
+	publishConfirmTimeout        = 10 * time.Second // сколько ждем подтверждения отправки от брокера
+	publishConfirmBufferSize     = 1000             // сколько подтверждений вмещает канал, больше без ожидания подтверждений не отправляем
 )
 
 // структура соединения
 type ConnectionStruct struct {
-	connection *amqp.Connection // соединение
-	key        string
-	channel    *amqp.Channel    // канал
-	errorChan  chan *amqp.Error // канал ошибок
-	createdAt  int64
+	connection     *amqp.Connection // соединение
+	key            string
+	channel        *amqp.Channel    // канал
+	errorChan      chan *amqp.Error // канал ошибок
+	createdAt      int64
+	confirmMu      sync.Mutex             // отправка с подтверждением идет по одной пачке за раз
+	confirmChannel *amqp.Channel          // канал в режиме подтверждений, открывается при первой отправке
+	confirmChan    chan amqp.Confirmation // подтверждения канала confirmChannel
 }
 
 // структура соединения
@@ -127,9 +132,42 @@ func (connectionItem *ConnectionStruct) SendMessageListToExchange(exchangeName s
 	}
 }
 
+// PublishMessageListToExchange отправляем сообщения в обменник и ждем подтверждения брокера
+// ошибка возвращается, если хотя бы одно сообщение не подтверждено – тогда их нужно отправить повторно
+func (connectionItem *ConnectionStruct) PublishMessageListToExchange(exchangeName string, messageList [][]byte) error {
+
+	connectionItem.confirmMu.Lock()
+	defer connectionItem.confirmMu.Unlock()
+
+	channel, err := connectionItem.getConfirmChannel()
+	if err != nil {
+		return err
+	}
+
+	// заполненный канал подтверждений блокирует и отправку, поэтому отправляем частями не больше его размера
+	for start := 0; start < len(messageList); start += publishConfirmBufferSize {
+
+		end := min(start+publishConfirmBufferSize, len(messageList))
+
+		// после ошибки в канале могут остаться подтверждения этой пачки – закрываем его, следующая отправка откроет новый
+		err = connectionItem.publishWithConfirm(channel, exchangeName, messageList[start:end])
+		if err != nil {
+
+			connectionItem.closeConfirmChannel()
+			return err
+		}
+	}
+
+	return nil
+}
+
 // закрываем все соединения
 func (connectionItem *ConnectionStruct) CloseAll() {
 
+	connectionItem.confirmMu.Lock()
+	connectionItem.closeConfirmChannel()
+	connectionItem.confirmMu.Unlock()
+
 	_ = connectionItem.channel.Close()
 	_ = connectionItem.connection.Close()
 }
@@ -138,6 +176,81 @@ func (connectionItem *ConnectionStruct) CloseAll() {
 // PROTECTED
 // -------------------------------------------------------
 
+// получаем канал в режиме подтверждений, открывая его при первом обращении
+// подтверждения включаем на отдельном канале, чтобы не смешивать их с остальными отправками
+func (connectionItem *ConnectionStruct) getConfirmChannel() (*amqp.Channel, error) {
+
+	if connectionItem.confirmChannel != nil {
+		return connectionItem.confirmChannel, nil
+	}
+
+	channel, err := connectionItem.connection.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("unable open channel, error: %w", err)
+	}
+
+	err = channel.Confirm(false)
+	if err != nil {
+
+		_ = channel.Close()
+		return nil, fmt.Errorf("unable enable publisher confirms, error: %w", err)
+	}
+
+	connectionItem.confirmChannel = channel
+	connectionItem.confirmChan = channel.NotifyPublish(make(chan amqp.Confirmation, publishConfirmBufferSize))
+	return channel, nil
+}
+
+// закрываем канал подтверждений
+func (connectionItem *ConnectionStruct) closeConfirmChannel() {
+
+	if connectionItem.confirmChannel == nil {
+		return
+	}
+
+	_ = connectionItem.confirmChannel.Close()
+	connectionItem.confirmChannel = nil
+	connectionItem.confirmChan = nil
+}
+
+// отправляем пачку в канал подтверждений и ждем подтверждения каждого сообщения
+func (connectionItem *ConnectionStruct) publishWithConfirm(channel *amqp.Channel, exchangeName string, messageList [][]byte) error {
+
+	for _, message := range messageList {
+
+		err := channel.Publish(exchangeName, "", false, false, amqp.Publishing{
+			DeliveryMode: amqp.Persistent,
+			Timestamp:    time.Now(),
+			ContentType:  "shortstr",
+			Body:         message,
+		})
+		if err != nil {
+			return fmt.Errorf("unable publish message to %s rabbitMq, error: %w", exchangeName, err)
+		}
+	}
+
+	timer := time.NewTimer(publishConfirmTimeout)
+	defer timer.Stop()
+
+	for range messageList {
+
+		select {
+		case confirm, ok := <-connectionItem.confirmChan:
+
+			if !ok {
+				return fmt.Errorf("channel closed before all messages to %s were confirmed", exchangeName)
+			}
+			if !confirm.Ack {
+				return fmt.Errorf("message %d to %s was rejected by rabbitMq", confirm.DeliveryTag, exchangeName)
+			}
+		case <-timer.C:
+			return fmt.Errorf("timeout waiting confirms from rabbitMq for %s", exchangeName)
+		}
+	}
+
+	return nil
+}
+
 // слушаем соединение
 func listenConnection(connectionItem *ConnectionStruct, queueName string, exchangeName string, callback func(body []byte) []byte) {
 